@@ -0,0 +1,81 @@
+package syncodec
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// AverageBitrate returns the average bitrate of frames in bits per second,
+// i.e. the total size of all frames divided by their total duration. It
+// returns 0 if the total duration is not positive.
+func AverageBitrate(frames []Frame) int {
+	bytes := int64(0)
+	duration := 0.0
+	for _, f := range frames {
+		bytes += int64(len(f.Content))
+		duration += f.Duration.Seconds()
+	}
+	if duration <= 0 {
+		return 0
+	}
+	return int(float64(8*bytes) / duration)
+}
+
+// ExpectedBytes returns the number of bytes a codec emitting exactly
+// bitrateBps produces in d. Compare it to CodecStats.BytesEmitted to check the
+// output of a codec against its target. It returns 0 if d is not positive.
+func ExpectedBytes(bitrateBps int, d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(float64(bitrateBps) * d.Seconds() / 8)
+}
+
+// TargetBitrateError returns the relative deviation of the average bitrate of
+// frames from targetBitrateBps. The result is negative if the frames undershoot
+// the target and positive if they overshoot it.
+func TargetBitrateError(frames []Frame, targetBitrateBps int) float64 {
+	return float64(AverageBitrate(frames)-targetBitrateBps) / float64(targetBitrateBps)
+}
+
+// RealizedFPS returns the frame rate of frames in frames per second, i.e. the
+// number of frames divided by their total duration. Frames without duration,
+// such as FEC frames or the lower spatial layers of a picture, do not count as
+// separate frames. It returns 0 if the total duration is not positive.
+func RealizedFPS(frames []Frame) float64 {
+	count := 0
+	duration := 0.0
+	for _, f := range frames {
+		if f.Duration <= 0 {
+			continue
+		}
+		count++
+		duration += f.Duration.Seconds()
+	}
+	if duration <= 0 {
+		return 0
+	}
+	return float64(count) / duration
+}
+
+// SizeHistogram counts the frames by size in bytes. Each bucket is identified
+// by its inclusive upper bound, and a frame is counted in the smallest bucket
+// whose bound is at least the size of the frame. Frames larger than all
+// bounds are counted under math.MaxInt. buckets may be given in any order.
+func SizeHistogram(frames []Frame, buckets []int) map[int]int {
+	bounds := make([]int, len(buckets))
+	copy(bounds, buckets)
+	sort.Ints(bounds)
+
+	histogram := make(map[int]int, len(bounds)+1)
+	for _, f := range frames {
+		i := sort.SearchInts(bounds, len(f.Content))
+		if i == len(bounds) {
+			histogram[math.MaxInt]++
+			continue
+		}
+		histogram[bounds[i]]++
+	}
+	return histogram
+}
@@ -0,0 +1,140 @@
+package syncodec
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+// synthFrames returns n frames of size bytes and duration d.
+func synthFrames(n, size int, d time.Duration) []Frame {
+	frames := make([]Frame, n)
+	for i := range frames {
+		frames[i] = Frame{Content: make([]byte, size), Duration: d}
+	}
+	return frames
+}
+
+func TestAverageBitrate(t *testing.T) {
+	// 30 frames of 1000 bytes per second are 240 kbps.
+	frames := synthFrames(30, 1000, time.Second/30)
+	if got := AverageBitrate(frames); got < 239_999 || got > 240_001 {
+		t.Errorf("average bitrate %v, want 240000", got)
+	}
+	if got := AverageBitrate(nil); got != 0 {
+		t.Errorf("average bitrate of no frames %v, want 0", got)
+	}
+	if got := AverageBitrate(synthFrames(3, 1000, 0)); got != 0 {
+		t.Errorf("average bitrate of frames without duration %v, want 0", got)
+	}
+}
+
+func TestTargetBitrateError(t *testing.T) {
+	frames := synthFrames(10, 1000, 100*time.Millisecond)
+	for target, want := range map[int]float64{
+		80_000:  0,
+		100_000: -0.2,
+		64_000:  0.25,
+	} {
+		if got := TargetBitrateError(frames, target); math.Abs(got-want) > 1e-6 {
+			t.Errorf("error against %v bps %v, want %v", target, got, want)
+		}
+	}
+}
+
+func TestSizeHistogram(t *testing.T) {
+	frames := []Frame{}
+	for _, size := range []int{0, 100, 100, 101, 500, 999, 1000, 1001, 5000} {
+		frames = append(frames, Frame{Content: make([]byte, size)})
+	}
+	got := SizeHistogram(frames, []int{1000, 100, 500})
+	want := map[int]int{100: 3, 500: 2, 1000: 2, math.MaxInt: 2}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("histogram %v, want %v", got, want)
+	}
+}
+
+func TestSizeHistogramOfLaplaceFrameSizes(t *testing.T) {
+	c, _, _ := newTestEncoder(t)
+	frames := make([]Frame, 0, 10_000)
+	for i := 0; i < cap(frames); i++ {
+		f, _ := c.nextFrame()
+		frames = append(frames, f)
+	}
+	b0 := float64(defaultTargetBitrateBps) / 8 / defaultFPS
+	lower := int(b0*(1-defaultScaleB)) - 1
+	upper := int(b0 * (1 + defaultScaleB))
+	histogram := SizeHistogram(frames, []int{lower, upper})
+	// A laplacian sample deviates by at most its scale with probability
+	// 1 - 1/e.
+	share := float64(histogram[upper]) / float64(len(frames))
+	if want := 1 - 1/math.E; math.Abs(share-want) > 0.02 {
+		t.Errorf("%.3f of the frames within one scale of b0, want %.3f", share, want)
+	}
+	if math.Abs(float64(histogram[lower]-histogram[math.MaxInt])) > 0.05*float64(len(frames)) {
+		t.Errorf("asymmetric tails of %v smaller and %v larger frames", histogram[lower], histogram[math.MaxInt])
+	}
+}
+
+func TestRealizedFPS(t *testing.T) {
+	if got := RealizedFPS(synthFrames(25, 100, 40*time.Millisecond)); math.Abs(got-25) > 1e-9 {
+		t.Errorf("realized FPS %v, want 25", got)
+	}
+	// Frames without duration, such as FEC frames, are skipped.
+	frames := append(synthFrames(10, 100, 100*time.Millisecond), synthFrames(5, 100, 0)...)
+	if got := RealizedFPS(frames); math.Abs(got-10) > 1e-9 {
+		t.Errorf("realized FPS %v with frames without duration, want 10", got)
+	}
+	if got := RealizedFPS(nil); got != 0 {
+		t.Errorf("realized FPS of no frames %v, want 0", got)
+	}
+}
+
+func TestStatisticalCodecRealizedFPS(t *testing.T) {
+	for _, fps := range []int{24, 30, 60} {
+		for _, scale := range []float64{0, 0.05, defaultScaleT} {
+			c, _, _ := newTestEncoder(t, WithFramesPerSecond(fps), WithDurationNoiseScale(scale), WithInitialTargetBitrate(defaultRMin))
+			frames := make([]Frame, 0, 20_000)
+			for i := 0; i < cap(frames); i++ {
+				f, _ := c.nextFrame()
+				frames = append(frames, f)
+			}
+			if got := RealizedFPS(frames); math.Abs(got-float64(fps)) > 0.005*float64(fps) {
+				t.Errorf("realized FPS %.3f at %v fps and duration noise scale %v", got, fps, scale)
+			}
+		}
+	}
+}
+
+func TestExpectedBytes(t *testing.T) {
+	for _, tc := range []struct {
+		bitrateBps int
+		d          time.Duration
+		want       int
+	}{
+		{1_000_000, 10 * time.Second, 1_250_000},
+		{2_500_000, 200 * time.Millisecond, 62_500},
+		{64_000, time.Minute, 480_000},
+		{1_000_000, 0, 0},
+		{1_000_000, -time.Second, 0},
+	} {
+		if got := ExpectedBytes(tc.bitrateBps, tc.d); got != tc.want {
+			t.Errorf("ExpectedBytes(%v, %v) = %v, want %v", tc.bitrateBps, tc.d, got, tc.want)
+		}
+	}
+}
+
+func TestExpectedBytesMatchesBytesEmitted(t *testing.T) {
+	c, w, clock := newTestEncoder(t, WithConstantBitrate())
+	startCodec(t, c)
+	clock.BlockUntil(1)
+
+	n := 10 * defaultFPS
+	nextFrames(t, clock, w, n)
+	waitFor(t, func() bool { return c.Stats().FramesEmitted == uint64(n) })
+	want := float64(ExpectedBytes(defaultTargetBitrateBps, 10*time.Second))
+	if got := float64(c.Stats().BytesEmitted); math.Abs(got-want) > 0.001*want {
+		t.Errorf("%v bytes emitted in 10s, want %v", got, want)
+	}
+}
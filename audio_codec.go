@@ -0,0 +1,144 @@
+package syncodec
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAudioBitrateBps     = 64_000 // 64 kbps
+	defaultAudioPacketDuration = 20 * time.Millisecond
+)
+
+var _ Codec = (*AudioCodec)(nil)
+
+// AudioCodec models a constant bitrate audio encoder such as Opus. It emits
+// frames of equal size at a fixed packet interval.
+type AudioCodec struct {
+	writer FrameWriter
+
+	// packet interval
+	packetDuration time.Duration
+
+	clock Clock
+
+	lock             sync.Mutex
+	targetBitrateBps int
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type AudioCodecOption func(*AudioCodec) error
+
+// WithAudioBitrate sets the bitrate of the audio encoder in bits per second.
+func WithAudioBitrate(bps int) AudioCodecOption {
+	return func(ac *AudioCodec) error {
+		if bps <= 0 {
+			return errors.New("audio bitrate must be positive")
+		}
+		ac.targetBitrateBps = bps
+		return nil
+	}
+}
+
+// WithAudioClock replaces the clock the audio encoder uses to schedule frames,
+// e.g. to run the encoder in virtual time.
+func WithAudioClock(clock Clock) AudioCodecOption {
+	return func(ac *AudioCodec) error {
+		if clock == nil {
+			return errors.New("clock must not be nil")
+		}
+		ac.clock = clock
+		return nil
+	}
+}
+
+// WithPacketDuration sets the duration of the audio frames.
+func WithPacketDuration(d time.Duration) AudioCodecOption {
+	return func(ac *AudioCodec) error {
+		if d <= 0 {
+			return errors.New("packet duration must be positive")
+		}
+		ac.packetDuration = d
+		return nil
+	}
+}
+
+func NewAudioEncoder(w FrameWriter, opts ...AudioCodecOption) (*AudioCodec, error) {
+	ac := &AudioCodec{
+		writer:           w,
+		packetDuration:   defaultAudioPacketDuration,
+		clock:            realClock{},
+		lock:             sync.Mutex{},
+		targetBitrateBps: defaultAudioBitrateBps,
+		done:             make(chan struct{}),
+	}
+	for _, opt := range opts {
+		if err := opt(ac); err != nil {
+			return nil, err
+		}
+	}
+	return ac, nil
+}
+
+// GetTargetBitrate returns the current target bitrate in bit per second.
+func (c *AudioCodec) GetTargetBitrate() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.targetBitrateBps
+}
+
+// SetTargetBitrate sets the target bitrate to r bits per second. Negative
+// bitrates are clamped to 0, which results in empty frames. The new bitrate
+// applies from the next frame on.
+func (c *AudioCodec) SetTargetBitrate(r int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.targetBitrateBps = max(r, 0)
+}
+
+// Start runs the AudioCodec and writes a frame every packet duration until
+// Close is called. Start blocks, so it is usually run in its own goroutine.
+// Errors returned by the FrameWriter are ignored.
+func (c *AudioCodec) Start() {
+	timer := c.clock.NewTimer(c.packetDuration)
+	defer timer.Stop()
+	deadline := c.clock.Now().Add(c.packetDuration)
+
+	seqNr := uint64(0)
+	pts := time.Duration(0)
+	for {
+		select {
+		case <-timer.C():
+			bitrate := c.GetTargetBitrate()
+			size := int(float64(bitrate) * c.packetDuration.Seconds() / 8)
+			c.writer.WriteFrame(Frame{
+				Content:       make([]byte, size),
+				Duration:      c.packetDuration,
+				SeqNr:         seqNr,
+				PTS:           pts,
+				CaptureTime:   c.clock.Now(),
+				TargetBitrate: bitrate,
+			})
+			seqNr++
+			pts += c.packetDuration
+			deadline = deadline.Add(c.packetDuration)
+			timer.Reset(deadline.Sub(c.clock.Now()))
+
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Close stops the AudioCodec. Calling Close more than once has no effect.
+func (c *AudioCodec) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	return nil
+}
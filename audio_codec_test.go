@@ -0,0 +1,68 @@
+package syncodec
+
+import (
+	"testing"
+	"time"
+)
+
+// startAudioCodec runs an AudioCodec writing to a chanWriter in virtual time
+// until the test ends.
+func startAudioCodec(t *testing.T, opts ...AudioCodecOption) (*AudioCodec, chanWriter, *fakeClock) {
+	t.Helper()
+	clock := newFakeClock()
+	w := newChanWriter()
+	c, err := NewAudioEncoder(w, append(opts, WithAudioClock(clock))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Start()
+	}()
+	t.Cleanup(func() {
+		c.Close()
+		<-done
+	})
+	return c, w, clock
+}
+
+func TestAudioCodecPacketRate(t *testing.T) {
+	_, w, clock := startAudioCodec(t, WithAudioBitrate(64_000), WithPacketDuration(20*time.Millisecond))
+	start := clock.Now()
+	n := 0
+	for {
+		clock.BlockUntil(1)
+		clock.Step()
+		if clock.Now().Sub(start) > time.Second {
+			break
+		}
+		f := receiveFrame(t, w)
+		if f.PTS != time.Duration(n)*20*time.Millisecond {
+			t.Errorf("packet %v has PTS %v", n, f.PTS)
+		}
+		if want := time.Duration(n+1) * 20 * time.Millisecond; f.CaptureTime.Sub(start) != want {
+			t.Errorf("packet %v captured after %v, want %v", n, f.CaptureTime.Sub(start), want)
+		}
+		if len(f.Content) != 160 {
+			t.Errorf("packet %v has %v bytes, want 160", n, len(f.Content))
+		}
+		n++
+	}
+	if n != 50 {
+		t.Errorf("%v packets per second, want 50", n)
+	}
+}
+
+func TestAudioCodecClampsNegativeBitrate(t *testing.T) {
+	c, w, clock := startAudioCodec(t)
+	c.SetTargetBitrate(-64_000)
+	if got := c.GetTargetBitrate(); got != 0 {
+		t.Errorf("target bitrate %v, want 0", got)
+	}
+	clock.BlockUntil(1)
+	clock.Step()
+	if f := receiveFrame(t, w); len(f.Content) != 0 {
+		t.Errorf("frame of %v bytes at bitrate 0", len(f.Content))
+	}
+}
@@ -0,0 +1,138 @@
+package syncodec
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+var _ FrameWriter = (*ChannelFrameWriter)(nil)
+
+// BackpressurePolicy selects how a ChannelFrameWriter handles frames written
+// while its buffer is full.
+type BackpressurePolicy int
+
+const (
+	// BackpressureBlock blocks WriteFrame until the consumer reads a frame.
+	// Combine it with WithWriteTimeout to bound the time the codec waits.
+	BackpressureBlock BackpressurePolicy = iota
+
+	// BackpressureDropNewest drops the frame being written.
+	BackpressureDropNewest
+
+	// BackpressureDropOldest drops the oldest buffered frame to make room for
+	// the frame being written.
+	BackpressureDropOldest
+)
+
+// ChannelFrameWriter is a FrameWriter which passes frames to an asynchronous
+// consumer through a bounded channel.
+type ChannelFrameWriter struct {
+	frames chan Frame
+	policy BackpressurePolicy
+
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// lock guards closed. Writes register in inflight while holding it, so
+	// that Close can wait for them before closing frames. It is not held
+	// while sending, so a blocked write does not block Dropped or Close.
+	lock     sync.Mutex
+	closed   bool
+	inflight sync.WaitGroup
+
+	dropped uint64
+}
+
+// NewChannelFrameWriter returns a ChannelFrameWriter which buffers up to
+// bufSize frames and handles a full buffer according to policy. The drop
+// policies require a buffer of at least one frame.
+func NewChannelFrameWriter(bufSize int, policy BackpressurePolicy) (*ChannelFrameWriter, error) {
+	if bufSize < 0 {
+		return nil, errors.New("channel frame writer buffer size must not be negative")
+	}
+	switch policy {
+	case BackpressureBlock:
+	case BackpressureDropNewest, BackpressureDropOldest:
+		if bufSize == 0 {
+			return nil, errors.New("drop policies require a buffer size of at least one frame")
+		}
+	default:
+		return nil, errors.New("unknown backpressure policy")
+	}
+	return &ChannelFrameWriter{
+		frames: make(chan Frame, bufSize),
+		policy: policy,
+		done:   make(chan struct{}),
+	}, nil
+}
+
+// C returns the channel frames are delivered on. The channel is closed by
+// Close.
+func (w *ChannelFrameWriter) C() <-chan Frame {
+	return w.frames
+}
+
+// Dropped returns the number of frames dropped because the buffer was full.
+func (w *ChannelFrameWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+// WriteFrame passes f to the consumer. Frames written after Close are dropped
+// and WriteFrame returns io.ErrClosedPipe. Frames dropped by the backpressure
+// policy are not reported as errors.
+func (w *ChannelFrameWriter) WriteFrame(f Frame) error {
+	w.lock.Lock()
+	if w.closed {
+		w.lock.Unlock()
+		return io.ErrClosedPipe
+	}
+	w.inflight.Add(1)
+	w.lock.Unlock()
+	defer w.inflight.Done()
+
+	switch w.policy {
+	case BackpressureDropNewest:
+		select {
+		case w.frames <- f:
+		default:
+			atomic.AddUint64(&w.dropped, 1)
+		}
+	case BackpressureDropOldest:
+		for {
+			select {
+			case w.frames <- f:
+				return nil
+			default:
+			}
+			select {
+			case <-w.frames:
+				atomic.AddUint64(&w.dropped, 1)
+			default:
+			}
+		}
+	default:
+		select {
+		case w.frames <- f:
+		case <-w.done:
+			return io.ErrClosedPipe
+		}
+	}
+	return nil
+}
+
+// Close unblocks pending writes and closes the channel returned by C. Frames
+// buffered before Close can still be read from the channel. Calling Close
+// more than once has no effect.
+func (w *ChannelFrameWriter) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+		w.lock.Lock()
+		w.closed = true
+		w.lock.Unlock()
+		w.inflight.Wait()
+		close(w.frames)
+	})
+	return nil
+}
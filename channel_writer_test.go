@@ -0,0 +1,114 @@
+package syncodec
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestChannelFrameWriterDropNewest(t *testing.T) {
+	w, err := NewChannelFrameWriter(2, BackpressureDropNewest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(0); i < 4; i++ {
+		if err := w.WriteFrame(Frame{SeqNr: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := w.Dropped(); got != 2 {
+		t.Errorf("dropped %v frames, want 2", got)
+	}
+	for _, want := range []uint64{0, 1} {
+		if f := <-w.C(); f.SeqNr != want {
+			t.Errorf("received frame %v, want %v", f.SeqNr, want)
+		}
+	}
+}
+
+func TestChannelFrameWriterDropOldest(t *testing.T) {
+	w, err := NewChannelFrameWriter(2, BackpressureDropOldest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(0); i < 4; i++ {
+		if err := w.WriteFrame(Frame{SeqNr: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := w.Dropped(); got != 2 {
+		t.Errorf("dropped %v frames, want 2", got)
+	}
+	for _, want := range []uint64{2, 3} {
+		if f := <-w.C(); f.SeqNr != want {
+			t.Errorf("received frame %v, want %v", f.SeqNr, want)
+		}
+	}
+}
+
+func TestChannelFrameWriterBlock(t *testing.T) {
+	w, err := NewChannelFrameWriter(1, BackpressureBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFrame(Frame{SeqNr: 0}); err != nil {
+		t.Fatal(err)
+	}
+	written := make(chan error, 1)
+	go func() {
+		written <- w.WriteFrame(Frame{SeqNr: 1})
+	}()
+
+	// Dropped must not wait for the blocked write.
+	dropped := make(chan uint64, 1)
+	go func() {
+		dropped <- w.Dropped()
+	}()
+	select {
+	case n := <-dropped:
+		if n != 0 {
+			t.Errorf("dropped %v frames, want 0", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Dropped blocked by pending write")
+	}
+
+	if f := <-w.C(); f.SeqNr != 0 {
+		t.Errorf("received frame %v, want 0", f.SeqNr)
+	}
+	if err := <-written; err != nil {
+		t.Fatal(err)
+	}
+	if f := <-w.C(); f.SeqNr != 1 {
+		t.Errorf("received frame %v, want 1", f.SeqNr)
+	}
+}
+
+func TestChannelFrameWriterCloseUnblocksWrite(t *testing.T) {
+	w, err := NewChannelFrameWriter(0, BackpressureBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	written := make(chan error, 1)
+	go func() {
+		written <- w.WriteFrame(Frame{})
+	}()
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-written:
+		// The write fails whether it started before or after Close.
+		if err != io.ErrClosedPipe {
+			t.Errorf("blocked write returned %v, want %v", err, io.ErrClosedPipe)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not unblock pending write")
+	}
+	if _, ok := <-w.C(); ok {
+		t.Error("channel not closed")
+	}
+	if err := w.WriteFrame(Frame{}); err != io.ErrClosedPipe {
+		t.Errorf("write after close returned %v, want %v", err, io.ErrClosedPipe)
+	}
+}
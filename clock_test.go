@@ -0,0 +1,195 @@
+package syncodec
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock for tests which only advances when told to. Timers
+// fire when the clock is advanced past their deadline.
+type fakeClock struct {
+	lock   sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers []*fakeTimer
+}
+
+func newFakeClock() *fakeClock {
+	c := &fakeClock{
+		now: time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}
+	c.cond = sync.NewCond(&c.lock)
+	return c
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) Timer {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	t := &fakeTimer{
+		clock: c,
+		c:     make(chan time.Time, 1),
+	}
+	c.timers = append(c.timers, t)
+	t.armLocked(d)
+	return t
+}
+
+// Advance moves the clock forward by d and fires all timers whose deadline
+// passed, in the order of their deadlines.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	target := c.now.Add(d)
+	for {
+		due := c.armedLocked()
+		if len(due) == 0 || due[0].deadline.After(target) {
+			break
+		}
+		c.now = due[0].deadline
+		due[0].fireLocked()
+	}
+	c.now = target
+}
+
+// Step advances the clock to the deadline of the next armed timer and fires
+// it. It returns the time the clock advanced by.
+func (c *fakeClock) Step() time.Duration {
+	c.lock.Lock()
+	armed := c.armedLocked()
+	if len(armed) == 0 {
+		c.lock.Unlock()
+		return 0
+	}
+	d := armed[0].deadline.Sub(c.now)
+	c.lock.Unlock()
+
+	c.Advance(d)
+	return d
+}
+
+// BlockUntil blocks until exactly n timers are armed. Since a firing timer
+// is disarmed until it is reset, this allows waiting until a run loop
+// handled a timer.
+func (c *fakeClock) BlockUntil(n int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for len(c.armedLocked()) != n {
+		c.cond.Wait()
+	}
+}
+
+// armedLocked returns the armed timers ordered by deadline.
+func (c *fakeClock) armedLocked() []*fakeTimer {
+	armed := []*fakeTimer{}
+	for _, t := range c.timers {
+		if t.armed {
+			armed = append(armed, t)
+		}
+	}
+	sort.SliceStable(armed, func(i, j int) bool {
+		return armed[i].deadline.Before(armed[j].deadline)
+	})
+	return armed
+}
+
+type fakeTimer struct {
+	clock    *fakeClock
+	c        chan time.Time
+	deadline time.Time
+	armed    bool
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+
+	wasArmed := t.armed
+	t.drainLocked()
+	t.armLocked(d)
+	return wasArmed
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+
+	wasArmed := t.armed
+	t.armed = false
+	t.drainLocked()
+	t.clock.cond.Broadcast()
+	return wasArmed
+}
+
+// armLocked arms the timer to fire d after the current time. Like a timer of
+// the time package, it fires at once if d is not positive.
+func (t *fakeTimer) armLocked(d time.Duration) {
+	t.deadline = t.clock.now.Add(d)
+	t.armed = true
+	if d <= 0 {
+		t.fireLocked()
+	}
+	t.clock.cond.Broadcast()
+}
+
+func (t *fakeTimer) fireLocked() {
+	t.armed = false
+	select {
+	case t.c <- t.clock.now:
+	default:
+	}
+	t.clock.cond.Broadcast()
+}
+
+func (t *fakeTimer) drainLocked() {
+	select {
+	case <-t.c:
+	default:
+	}
+}
+
+func TestFakeClockFiresTimersInOrder(t *testing.T) {
+	clock := newFakeClock()
+	start := clock.Now()
+	late := clock.NewTimer(20 * time.Millisecond)
+	early := clock.NewTimer(10 * time.Millisecond)
+
+	clock.Advance(15 * time.Millisecond)
+	select {
+	case now := <-early.C():
+		if got := now.Sub(start); got != 10*time.Millisecond {
+			t.Errorf("early timer fired at %v, want 10ms", got)
+		}
+	default:
+		t.Fatal("early timer did not fire")
+	}
+	select {
+	case <-late.C():
+		t.Fatal("late timer fired early")
+	default:
+	}
+	if late.Stop() != true {
+		t.Error("Stop of armed timer returned false")
+	}
+	clock.Advance(time.Second)
+	select {
+	case <-late.C():
+		t.Fatal("stopped timer fired")
+	default:
+	}
+}
@@ -1,26 +1,127 @@
 package syncodec
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"time"
 )
 
 type Frame struct {
 	Content  []byte
 	Duration time.Duration
+
+	// SeqNr is the sequence number of the frame. It starts at 0 and is
+	// incremented by one for every frame generated by a codec.
+	SeqNr uint64
+
+	// PTS is the presentation timestamp of the frame relative to the first
+	// frame. It advances by the Duration of each frame.
+	PTS time.Duration
+
+	// CaptureTime is the wall-clock time at which the codec generated the
+	// frame according to its clock. In contrast to PTS, which is media time,
+	// it allows correlating frames with external events. Codecs without a
+	// clock leave it zero.
+	CaptureTime time.Time
+
+	// TargetBitrate is the target bitrate in bits per second the codec used
+	// when it generated the frame.
+	TargetBitrate int
+
+	// LayerID identifies the simulcast layer which generated the frame.
+	LayerID int
+
+	// SpatialLayerID is the SVC spatial layer of the frame. The frames of all
+	// spatial layers of a picture share the PTS, and frames of layer n
+	// depend on the frame of layer n-1 of the same picture.
+	SpatialLayerID int
+
+	// TemporalLayerID is the SVC temporal layer of the frame. Frames of layer
+	// n only depend on frames of layers <= n.
+	TemporalLayerID int
+
+	// IsKeyFrame is true for frames which can be decoded independently of
+	// previous frames.
+	IsKeyFrame bool
+
+	// IsFEC is true for frames carrying forward error correction data
+	// protecting the preceding media frames.
+	IsFEC bool
+}
+
+// Bitrate returns the bitrate in bits per second the frame represents, i.e.
+// its size divided by its duration. Frames without duration, such as FEC
+// frames, have a bitrate of 0.
+func (f Frame) Bitrate() int {
+	if f.Duration <= 0 {
+		return 0
+	}
+	return int(float64(len(f.Content)*8) / f.Duration.Seconds())
 }
 
+// String returns a summary of the frame for logging and debugging.
 func (f Frame) String() string {
-	return fmt.Sprintf("FRAME: \n\tDURATION: %v\n\tSIZE: %v\n", f.Duration, len(f.Content))
+	flags := ""
+	if f.IsKeyFrame {
+		flags += " KEY"
+	}
+	if f.IsFEC {
+		flags += " FEC"
+	}
+	return fmt.Sprintf("FRAME %v:%v\n\tPTS: %v\n\tDURATION: %v\n\tSIZE: %v\n\tLAYER: %v (SPATIAL: %v, TEMPORAL: %v)\n", f.SeqNr, flags, f.PTS, f.Duration, len(f.Content), f.LayerID, f.SpatialLayerID, f.TemporalLayerID)
+}
+
+// Reader returns an io.Reader reading the content of f. The reader shares the
+// underlying buffer with f instead of copying it.
+func (f Frame) Reader() io.Reader {
+	return bytes.NewReader(f.Content)
+}
+
+// Clone returns a copy of f with its own copy of the content. FrameWriters
+// which retain frames after WriteFrame returns must clone them if the codec
+// may reuse content buffers, e.g. if buffer pooling is enabled.
+func (f Frame) Clone() Frame {
+	if f.Content != nil {
+		content := make([]byte, len(f.Content))
+		copy(content, f.Content)
+		f.Content = content
+	}
+	return f
 }
 
+// Codec is the interface implemented by all synthetic encoders. Every codec
+// type asserts that it implements Codec at compile time.
 type Codec interface {
+	// GetTargetBitrate returns the current target bitrate in bits per second.
+	// Codecs which do not support rate adaptation return the fixed bitrate
+	// they produce.
 	GetTargetBitrate() int
+
+	// SetTargetBitrate requests a new target bitrate in bits per second.
+	// Codecs which do not support rate adaptation ignore the request, so
+	// that GetTargetBitrate keeps returning their fixed bitrate. It is safe
+	// to call GetTargetBitrate and SetTargetBitrate concurrently with Start.
 	SetTargetBitrate(int)
+
+	// Start runs the codec and blocks until Close is called. Callers which
+	// need to continue working while frames are generated should run Start
+	// in its own goroutine.
 	Start()
+
+	// Close stops the codec. Calling Close more than once has no effect.
 	Close() error
 }
 
+// FrameWriter is the interface implemented by consumers of the frames
+// generated by a Codec. WriteFrame returns an error if the frame could not be
+// consumed, e.g. because the underlying transport failed.
 type FrameWriter interface {
-	WriteFrame(Frame)
+	WriteFrame(Frame) error
+}
+
+// FrameReader is the interface implemented by frame sources. ReadFrame returns
+// io.EOF when no more frames are available.
+type FrameReader interface {
+	ReadFrame() (Frame, error)
 }
@@ -0,0 +1,87 @@
+package syncodec
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestFrameReaderSharesContent(t *testing.T) {
+	f := Frame{Content: []byte{1, 2, 3}}
+	got, err := io.ReadAll(f.Reader())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, f.Content) {
+		t.Errorf("read %v, want %v", got, f.Content)
+	}
+}
+
+// keyFrameContent is the content of a large key frame read by the benchmarks.
+var keyFrameContent = make([]byte, 64*1024)
+
+func BenchmarkFrameReader(b *testing.B) {
+	f := Frame{Content: keyFrameContent}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		io.Copy(io.Discard, f.Reader())
+	}
+}
+
+func BenchmarkFrameContentCopyReader(b *testing.B) {
+	f := Frame{Content: keyFrameContent}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		content := make([]byte, len(f.Content))
+		copy(content, f.Content)
+		io.Copy(io.Discard, bytes.NewReader(content))
+	}
+}
+
+func TestFrameCloneIsIndependent(t *testing.T) {
+	f := Frame{Content: []byte{1, 2, 3}, SeqNr: 7, IsKeyFrame: true}
+	clone := f.Clone()
+	f.Content[0] = 42
+	if !bytes.Equal(clone.Content, []byte{1, 2, 3}) {
+		t.Errorf("clone content %v changed with the original", clone.Content)
+	}
+	if clone.SeqNr != 7 || !clone.IsKeyFrame {
+		t.Errorf("clone %+v lost metadata", clone)
+	}
+	if (Frame{}).Clone().Content != nil {
+		t.Error("clone of frame without content has content")
+	}
+}
+
+func TestFrameBitrate(t *testing.T) {
+	f := Frame{Content: make([]byte, 1000), Duration: 40 * time.Millisecond}
+	if got := f.Bitrate(); got != 200_000 {
+		t.Errorf("bitrate %v, want 200000", got)
+	}
+	f.Duration = 0
+	if got := f.Bitrate(); got != 0 {
+		t.Errorf("bitrate %v without duration, want 0", got)
+	}
+}
+
+func TestFrameString(t *testing.T) {
+	f := Frame{
+		Content:         make([]byte, 1200),
+		Duration:        40 * time.Millisecond,
+		SeqNr:           3,
+		PTS:             120 * time.Millisecond,
+		LayerID:         1,
+		SpatialLayerID:  2,
+		TemporalLayerID: 0,
+		IsKeyFrame:      true,
+		IsFEC:           true,
+	}
+	want := "FRAME 3: KEY FEC\n\tPTS: 120ms\n\tDURATION: 40ms\n\tSIZE: 1200\n\tLAYER: 1 (SPATIAL: 2, TEMPORAL: 0)\n"
+	if got := f.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := (Frame{}).String(); got != "FRAME 0:\n\tPTS: 0s\n\tDURATION: 0s\n\tSIZE: 0\n\tLAYER: 0 (SPATIAL: 0, TEMPORAL: 0)\n" {
+		t.Errorf("got %q for frame without flags", got)
+	}
+}
@@ -0,0 +1,78 @@
+package syncodec
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// Config is a profile of StatisticalCodec parameters, e.g. to keep the
+// parameters of an experiment in a JSON file. Parameters which are not set
+// keep their defaults.
+type Config struct {
+	FPS                *int     `json:"fps,omitempty"`
+	TargetBitrateBps   *int     `json:"target_bitrate_bps,omitempty"`
+	MinBitrateBps      *int     `json:"min_bitrate_bps,omitempty"`
+	MaxBitrateBps      *int     `json:"max_bitrate_bps,omitempty"`
+	ReactionLatencyMs  *float64 `json:"reaction_latency_ms,omitempty"`
+	BurstFrameCount    *int     `json:"burst_frame_count,omitempty"`
+	BurstFrameSize     *int     `json:"burst_frame_size,omitempty"`
+	SizeNoiseScale     *float64 `json:"size_noise_scale,omitempty"`
+	DurationNoiseScale *float64 `json:"duration_noise_scale,omitempty"`
+	Seed               *int64   `json:"seed,omitempty"`
+}
+
+// Options returns the options which configure a StatisticalCodec according
+// to cfg. The options are validated when they are passed to
+// NewStatisticalEncoder.
+func (cfg Config) Options() []StatisticalCodecOption {
+	opts := []StatisticalCodecOption{}
+	if cfg.FPS != nil {
+		opts = append(opts, WithFramesPerSecond(*cfg.FPS))
+	}
+	if cfg.MinBitrateBps != nil || cfg.MaxBitrateBps != nil {
+		min, max := defaultRMin, defaultRMax
+		if cfg.MinBitrateBps != nil {
+			min = *cfg.MinBitrateBps
+		}
+		if cfg.MaxBitrateBps != nil {
+			max = *cfg.MaxBitrateBps
+		}
+		opts = append(opts, WithRateBounds(min, max))
+	}
+	if cfg.TargetBitrateBps != nil {
+		opts = append(opts, WithInitialTargetBitrate(*cfg.TargetBitrateBps))
+	}
+	if cfg.ReactionLatencyMs != nil {
+		tau := time.Duration(*cfg.ReactionLatencyMs * float64(time.Millisecond))
+		opts = append(opts, WithReactionLatency(tau))
+	}
+	if cfg.BurstFrameCount != nil {
+		opts = append(opts, WithBurstFrameCount(*cfg.BurstFrameCount))
+	}
+	if cfg.BurstFrameSize != nil {
+		opts = append(opts, WithBurstFrameSize(*cfg.BurstFrameSize))
+	}
+	if cfg.SizeNoiseScale != nil {
+		opts = append(opts, WithSizeNoiseScale(*cfg.SizeNoiseScale))
+	}
+	if cfg.DurationNoiseScale != nil {
+		opts = append(opts, WithDurationNoiseScale(*cfg.DurationNoiseScale))
+	}
+	if cfg.Seed != nil {
+		opts = append(opts, WithRandSeed(*cfg.Seed))
+	}
+	return opts
+}
+
+// LoadProfile reads a JSON encoded Config from r and returns the options it
+// describes. Unknown fields are rejected to catch typos in profiles.
+func LoadProfile(r io.Reader) ([]StatisticalCodecOption, error) {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	var cfg Config
+	if err := decoder.Decode(&cfg); err != nil {
+		return nil, err
+	}
+	return cfg.Options(), nil
+}
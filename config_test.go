@@ -0,0 +1,69 @@
+package syncodec
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigRoundTrip(t *testing.T) {
+	fps, target, min, max := 25, 800_000, 200_000, 2_000_000
+	tau, burstCount, burstSize := 150.0, 6, 20_000
+	sizeScale, durationScale := 0.1, 0.05
+	seed := int64(7)
+	cfg := Config{
+		FPS:                &fps,
+		TargetBitrateBps:   &target,
+		MinBitrateBps:      &min,
+		MaxBitrateBps:      &max,
+		ReactionLatencyMs:  &tau,
+		BurstFrameCount:    &burstCount,
+		BurstFrameSize:     &burstSize,
+		SizeNoiseScale:     &sizeScale,
+		DurationNoiseScale: &durationScale,
+		Seed:               &seed,
+	}
+	profile, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := LoadProfile(bytes.NewReader(profile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewStatisticalEncoder(newChanWriter(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.fps != fps || c.GetTargetBitrate() != target || c.rMin != min || c.rMax != max {
+		t.Errorf("codec has fps %v, target %v and bounds [%v, %v]", c.fps, c.GetTargetBitrate(), c.rMin, c.rMax)
+	}
+	if c.tau != 150*time.Millisecond || c.burstFrameCount != burstCount || c.burstFrameSize != burstSize {
+		t.Errorf("codec has tau %v and burst of %v frames with %v bytes", c.tau, c.burstFrameCount, c.burstFrameSize)
+	}
+	if c.scaleB != sizeScale || c.scaleT != durationScale || c.seed != seed {
+		t.Errorf("codec has noise scales %v and %v and seed %v", c.scaleB, c.scaleT, c.seed)
+	}
+}
+
+func TestLoadProfileRejectsUnknownFields(t *testing.T) {
+	if _, err := LoadProfile(strings.NewReader(`{"fsp": 30}`)); err == nil {
+		t.Error("expected error for unknown field")
+	}
+}
+
+func TestLoadProfileKeepsDefaults(t *testing.T) {
+	opts, err := LoadProfile(strings.NewReader(`{"fps": 60}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewStatisticalEncoder(newChanWriter(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.fps != 60 || c.GetTargetBitrate() != defaultTargetBitrateBps || c.rMin != defaultRMin {
+		t.Errorf("codec has fps %v, target %v and min bitrate %v", c.fps, c.GetTargetBitrate(), c.rMin)
+	}
+}
@@ -0,0 +1,39 @@
+package syncodec
+
+import (
+	"errors"
+	"io"
+)
+
+// SyncCodecDecoder is the receiving counterpart of the synthetic encoders. It
+// reads frames from a FrameReader and hands them to a FrameWriter, which
+// models the consumer of the decoded frames, e.g. a renderer.
+type SyncCodecDecoder struct {
+	reader FrameReader
+	writer FrameWriter
+}
+
+func NewSyncCodecDecoder(r FrameReader, w FrameWriter) *SyncCodecDecoder {
+	return &SyncCodecDecoder{
+		reader: r,
+		writer: w,
+	}
+}
+
+// Start decodes frames until the FrameReader or the FrameWriter returns an
+// error. Start blocks and returns nil if the reader returned io.EOF, or the
+// read or write error otherwise.
+func (d *SyncCodecDecoder) Start() error {
+	for {
+		f, err := d.reader.ReadFrame()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if err := d.writer.WriteFrame(f); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package syncodec
+
+import "testing"
+
+func TestSyncCodecDecoderReadsEncoderOutput(t *testing.T) {
+	clock := newFakeClock()
+	pipe := NewFramePipe(16)
+	enc, err := NewStatisticalEncoder(pipe, WithClock(clock), WithRandSeed(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := &RecordingFrameWriter{}
+	dec := NewSyncCodecDecoder(pipe, rec)
+	decoded := make(chan error, 1)
+	go func() {
+		decoded <- dec.Start()
+	}()
+	startCodec(t, enc)
+
+	for i := 0; i < 5; i++ {
+		clock.BlockUntil(1)
+		clock.Step()
+	}
+	waitFor(t, func() bool { return enc.Stats().FramesEmitted == 5 })
+	enc.Close()
+	pipe.Close()
+	if err := <-decoded; err != nil {
+		t.Fatalf("decoder returned %v", err)
+	}
+
+	frames := rec.Frames()
+	if len(frames) != 5 {
+		t.Fatalf("decoded %v frames, want 5", len(frames))
+	}
+	for i, f := range frames {
+		if f.SeqNr != uint64(i) {
+			t.Errorf("frame %v decoded with sequence number %v", i, f.SeqNr)
+		}
+	}
+}
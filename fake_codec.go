@@ -0,0 +1,62 @@
+package syncodec
+
+import "sync"
+
+var _ Codec = (*FakeCodec)(nil)
+
+// FakeCodec is a Codec for tests of packages depending on syncodec. It does not
+// generate frames on its own, instead frames are written to the FrameWriter on
+// demand by EmitFrame. The target bitrate is stored but has no further effect.
+type FakeCodec struct {
+	writer FrameWriter
+
+	lock             sync.Mutex
+	targetBitrateBps int
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewFakeCodec(writer FrameWriter, targetBitrateBps int) *FakeCodec {
+	return &FakeCodec{
+		writer:           writer,
+		targetBitrateBps: targetBitrateBps,
+		done:             make(chan struct{}),
+	}
+}
+
+// GetTargetBitrate returns the target bitrate last set by SetTargetBitrate.
+func (c *FakeCodec) GetTargetBitrate() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.targetBitrateBps
+}
+
+// SetTargetBitrate sets the target bitrate to r bits per second.
+func (c *FakeCodec) SetTargetBitrate(r int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.targetBitrateBps = r
+}
+
+// EmitFrame writes f to the FrameWriter and returns the error of the
+// FrameWriter. EmitFrame may be called regardless of whether Start is
+// running.
+func (c *FakeCodec) EmitFrame(f Frame) error {
+	return c.writer.WriteFrame(f)
+}
+
+// Start blocks until Close is called.
+func (c *FakeCodec) Start() {
+	<-c.done
+}
+
+// Close stops the FakeCodec. Calling Close more than once has no effect.
+func (c *FakeCodec) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	return nil
+}
@@ -0,0 +1,55 @@
+package syncodec
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFakeCodec(t *testing.T) {
+	w := newChanWriter()
+	c := NewFakeCodec(w, 500_000)
+	if got := c.GetTargetBitrate(); got != 500_000 {
+		t.Errorf("target bitrate %v, want 500000", got)
+	}
+	c.SetTargetBitrate(250_000)
+	if got := c.GetTargetBitrate(); got != 250_000 {
+		t.Errorf("target bitrate %v after SetTargetBitrate, want 250000", got)
+	}
+
+	// Frames are written on demand, whether or not Start is running.
+	if err := c.EmitFrame(Frame{SeqNr: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if f := receiveFrame(t, w); f.SeqNr != 1 {
+		t.Errorf("frame %v written, want 1", f.SeqNr)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Start()
+	}()
+	if err := c.EmitFrame(Frame{SeqNr: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if f := receiveFrame(t, w); f.SeqNr != 2 {
+		t.Errorf("frame %v written, want 2", f.SeqNr)
+	}
+	expectNoFrame(t, w)
+
+	c.Close()
+	c.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start did not return after Close")
+	}
+}
+
+func TestFakeCodecEmitFrameReturnsWriterError(t *testing.T) {
+	writeErr := errors.New("write failed")
+	c := NewFakeCodec(errWriter{writeErr}, 0)
+	if err := c.EmitFrame(Frame{}); err != writeErr {
+		t.Errorf("EmitFrame returned %v, want %v", err, writeErr)
+	}
+}
@@ -0,0 +1,67 @@
+package syncodec
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// InterFrameModel generates the intervals between frames of sources which do
+// not capture frames at a constant rate, e.g. screen sharing, which only
+// emits frames when the screen changes.
+type InterFrameModel interface {
+	NextDuration() time.Duration
+}
+
+type exponentialInterFrameModel struct {
+	rnd  *rand.Rand
+	rate float64
+}
+
+// NewExponentialInterFrameModel returns an InterFrameModel drawing intervals
+// from an exponential distribution, i.e. frames arrive as a poisson process
+// with a mean rate of rate frames per second. It returns an error if rate is
+// not positive.
+func NewExponentialInterFrameModel(rate float64, src rand.Source) (InterFrameModel, error) {
+	if rate <= 0 {
+		return nil, errors.New("frame rate must be positive")
+	}
+	return exponentialInterFrameModel{
+		rnd:  rand.New(src),
+		rate: rate,
+	}, nil
+}
+
+func (e exponentialInterFrameModel) NextDuration() time.Duration {
+	return time.Duration(e.rnd.ExpFloat64() / e.rate * float64(time.Second))
+}
+
+type weibullInterFrameModel struct {
+	rnd   *rand.Rand
+	shape float64
+	scale time.Duration
+}
+
+// NewWeibullInterFrameModel returns an InterFrameModel drawing intervals from
+// a weibull distribution with the given shape and scale parameters. A shape
+// of 1 yields exponentially distributed intervals, smaller shapes yield
+// burstier arrivals. It returns an error if shape or scale is not positive.
+func NewWeibullInterFrameModel(shape float64, scale time.Duration, src rand.Source) (InterFrameModel, error) {
+	if shape <= 0 {
+		return nil, errors.New("weibull shape must be positive")
+	}
+	if scale <= 0 {
+		return nil, errors.New("weibull scale must be positive")
+	}
+	return weibullInterFrameModel{
+		rnd:   rand.New(src),
+		shape: shape,
+		scale: scale,
+	}, nil
+}
+
+func (w weibullInterFrameModel) NextDuration() time.Duration {
+	u := 1 - w.rnd.Float64()
+	return time.Duration(float64(w.scale) * math.Pow(-math.Log(u), 1/w.shape))
+}
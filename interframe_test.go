@@ -0,0 +1,85 @@
+package syncodec
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// meanDuration returns the mean of n intervals drawn from model.
+func meanDuration(model InterFrameModel, n int) time.Duration {
+	total := time.Duration(0)
+	for i := 0; i < n; i++ {
+		total += model.NextDuration()
+	}
+	return total / time.Duration(n)
+}
+
+func TestExponentialInterFrameModelMean(t *testing.T) {
+	model, err := NewExponentialInterFrameModel(5, rand.NewSource(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mean := meanDuration(model, 100_000)
+	if want := 200 * time.Millisecond; math.Abs(float64(mean-want)) > 0.02*float64(want) {
+		t.Errorf("mean interval %v, want %v", mean, want)
+	}
+}
+
+func TestWeibullInterFrameModelMean(t *testing.T) {
+	shape, scale := 0.7, 100*time.Millisecond
+	model, err := NewWeibullInterFrameModel(shape, scale, rand.NewSource(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mean := meanDuration(model, 100_000)
+	want := time.Duration(float64(scale) * math.Gamma(1+1/shape))
+	if math.Abs(float64(mean-want)) > 0.03*float64(want) {
+		t.Errorf("mean interval %v, want %v", mean, want)
+	}
+}
+
+func TestInterFrameModelsRejectInvalidParameters(t *testing.T) {
+	for _, rate := range []float64{0, -5} {
+		if _, err := NewExponentialInterFrameModel(rate, rand.NewSource(1)); err == nil {
+			t.Errorf("expected error for exponential rate %v", rate)
+		}
+	}
+	for _, tc := range []struct {
+		shape float64
+		scale time.Duration
+	}{
+		{0, 100 * time.Millisecond},
+		{-0.7, 100 * time.Millisecond},
+		{0.7, 0},
+		{0.7, -100 * time.Millisecond},
+	} {
+		if _, err := NewWeibullInterFrameModel(tc.shape, tc.scale, rand.NewSource(1)); err == nil {
+			t.Errorf("expected error for weibull shape %v and scale %v", tc.shape, tc.scale)
+		}
+	}
+}
+
+func TestStatisticalCodecInterFrameModelArrivalRate(t *testing.T) {
+	const rate = 10
+	model, err := NewExponentialInterFrameModel(rate, rand.NewSource(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, w, clock := newTestEncoder(t, WithInterFrameModel(model))
+	startCodec(t, c)
+	clock.BlockUntil(1)
+
+	frames := nextFrames(t, clock, w, 1001)
+	elapsed := frames[len(frames)-1].CaptureTime.Sub(frames[0].CaptureTime)
+	mean := elapsed / time.Duration(len(frames)-1)
+	if want := time.Second / rate; math.Abs(float64(mean-want)) > 0.1*float64(want) {
+		t.Errorf("mean inter-arrival time %v, want %v", mean, want)
+	}
+	for i, f := range frames[:len(frames)-1] {
+		if got := frames[i+1].CaptureTime.Sub(f.CaptureTime); got != f.Duration {
+			t.Fatalf("frame %v has duration %v, but the next frame follows after %v", i, f.Duration, got)
+		}
+	}
+}
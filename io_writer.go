@@ -0,0 +1,97 @@
+package syncodec
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+	"time"
+)
+
+var (
+	_ FrameWriter = (*IOFrameWriter)(nil)
+	_ FrameReader = (*IOFrameReader)(nil)
+)
+
+// frameHeaderSize is the size of the header preceding each frame on the wire:
+// a 4 byte content length followed by the 8 byte frame duration in
+// nanoseconds, both in network byte order.
+const frameHeaderSize = 12
+
+// IOFrameWriter serializes frames to an io.Writer. Each frame is written as a
+// header containing the length of the content and the duration of the frame,
+// followed by the content. Use an IOFrameReader to decode the stream.
+type IOFrameWriter struct {
+	lock   sync.Mutex
+	writer io.Writer
+	err    error
+}
+
+func NewIOFrameWriter(w io.Writer) *IOFrameWriter {
+	return &IOFrameWriter{
+		writer: w,
+	}
+}
+
+// WriteFrame writes f to the underlying io.Writer. After a write failed, all
+// subsequent frames are discarded and WriteFrame and Err return the error.
+func (w *IOFrameWriter) WriteFrame(f Frame) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+	var header [frameHeaderSize]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(f.Content)))
+	binary.BigEndian.PutUint64(header[4:], uint64(f.Duration))
+	if _, err := w.writer.Write(header[:]); err != nil {
+		w.err = err
+		return err
+	}
+	if _, err := w.writer.Write(f.Content); err != nil {
+		w.err = err
+	}
+	return w.err
+}
+
+// Err returns the first error that occurred while writing frames.
+func (w *IOFrameWriter) Err() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.err
+}
+
+// IOFrameReader decodes frames written by an IOFrameWriter from an io.Reader.
+type IOFrameReader struct {
+	reader io.Reader
+}
+
+func NewIOFrameReader(r io.Reader) *IOFrameReader {
+	return &IOFrameReader{
+		reader: r,
+	}
+}
+
+// ReadFrame reads the next frame from the underlying io.Reader. It returns
+// io.EOF if the stream ended cleanly between two frames, and
+// io.ErrUnexpectedEOF if it ended in the middle of a frame.
+func (r *IOFrameReader) ReadFrame() (Frame, error) {
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(r.reader, header[:]); err != nil {
+		return Frame{}, err
+	}
+	size := binary.BigEndian.Uint32(header[:4])
+	duration := time.Duration(binary.BigEndian.Uint64(header[4:]))
+	content := make([]byte, size)
+	if _, err := io.ReadFull(r.reader, content); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Frame{}, err
+	}
+	return Frame{
+		Content:  content,
+		Duration: duration,
+	}, nil
+}
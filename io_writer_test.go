@@ -0,0 +1,46 @@
+package syncodec
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestIOFrameWriterRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewIOFrameWriter(&buf)
+	written := []Frame{
+		{Content: []byte{1, 2, 3}, Duration: 33 * time.Millisecond},
+		{Content: []byte{}, Duration: 20 * time.Millisecond},
+		{Content: bytes.Repeat([]byte{7}, 5000), Duration: time.Second},
+	}
+	for _, f := range written {
+		if err := w.WriteFrame(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := NewIOFrameReader(&buf)
+	for i, want := range written {
+		f, err := r.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(f.Content, want.Content) || f.Duration != want.Duration {
+			t.Errorf("frame %v decoded with %v bytes and duration %v, want %v bytes and duration %v", i, len(f.Content), f.Duration, len(want.Content), want.Duration)
+		}
+	}
+	if _, err := r.ReadFrame(); err != io.EOF {
+		t.Errorf("read after last frame returned %v, want %v", err, io.EOF)
+	}
+}
+
+func TestIOFrameReaderTruncatedFrame(t *testing.T) {
+	var buf bytes.Buffer
+	NewIOFrameWriter(&buf).WriteFrame(Frame{Content: make([]byte, 10)})
+	buf.Truncate(buf.Len() - 1)
+	if _, err := NewIOFrameReader(&buf).ReadFrame(); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated frame returned %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
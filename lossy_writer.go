@@ -0,0 +1,69 @@
+package syncodec
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+)
+
+var _ FrameWriter = (*LossyFrameWriter)(nil)
+
+// LossyFrameWriter is a FrameWriter which simulates a lossy encoder or channel
+// by randomly dropping or truncating frames before passing them to another
+// FrameWriter. Frames keep the sequence numbers assigned by the codec, such
+// that receivers can detect dropped frames by gaps in the sequence numbers.
+type LossyFrameWriter struct {
+	writer FrameWriter
+
+	// probability that a frame is dropped
+	dropProbability float64
+
+	// probability that a frame which is not dropped is truncated
+	truncateProbability float64
+
+	lock sync.Mutex
+	rnd  *rand.Rand
+}
+
+// NewLossyFrameWriter returns a LossyFrameWriter writing to w, which drops
+// each frame with probability dropProbability and truncates the content of
+// each remaining frame to a random length with probability
+// truncateProbability. The random decisions are derived from seed, so runs
+// with the same seed and the same frames drop and truncate the same frames.
+func NewLossyFrameWriter(w FrameWriter, dropProbability, truncateProbability float64, seed int64) (*LossyFrameWriter, error) {
+	if dropProbability < 0 || dropProbability > 1 {
+		return nil, fmt.Errorf("drop probability %v out of range [0, 1]", dropProbability)
+	}
+	if truncateProbability < 0 || truncateProbability > 1 {
+		return nil, fmt.Errorf("truncate probability %v out of range [0, 1]", truncateProbability)
+	}
+	return &LossyFrameWriter{
+		writer:              w,
+		dropProbability:     dropProbability,
+		truncateProbability: truncateProbability,
+		lock:                sync.Mutex{},
+		rnd:                 rand.New(rand.NewSource(seed)),
+	}, nil
+}
+
+// WriteFrame drops, truncates or forwards f. Both random decisions are drawn
+// for every frame, independent of the outcome of the first one. Dropping a
+// frame is not an error.
+func (w *LossyFrameWriter) WriteFrame(f Frame) error {
+	w.lock.Lock()
+	drop := w.rnd.Float64() < w.dropProbability
+	truncate := w.rnd.Float64() < w.truncateProbability
+	length := len(f.Content)
+	if length > 0 {
+		length = w.rnd.Intn(length)
+	}
+	w.lock.Unlock()
+
+	if drop {
+		return nil
+	}
+	if truncate {
+		f.Content = f.Content[:length]
+	}
+	return w.writer.WriteFrame(f)
+}
@@ -0,0 +1,68 @@
+package syncodec
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestLossyFrameWriterDropsSeededFrames(t *testing.T) {
+	const seed, n = 42, 200
+	w := newChanWriter()
+	lw, err := NewLossyFrameWriter(w, 0.2, 0.1, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Replay the random decisions of the writer.
+	rnd := rand.New(rand.NewSource(seed))
+	dropped := map[uint64]bool{}
+	truncated := map[uint64]int{}
+	for i := uint64(0); i < n; i++ {
+		drop := rnd.Float64() < 0.2
+		truncate := rnd.Float64() < 0.1
+		length := rnd.Intn(100)
+		if drop {
+			dropped[i] = true
+		} else if truncate {
+			truncated[i] = length
+		}
+		if err := lw.WriteFrame(Frame{Content: make([]byte, 100), SeqNr: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(w)
+
+	if len(dropped) == 0 || len(truncated) == 0 {
+		t.Fatalf("seed drops %v and truncates %v frames, want both", len(dropped), len(truncated))
+	}
+	next := uint64(0)
+	for f := range w {
+		for dropped[next] {
+			next++
+		}
+		if f.SeqNr != next {
+			t.Fatalf("frame %v written, want %v", f.SeqNr, next)
+		}
+		want := 100
+		if length, ok := truncated[f.SeqNr]; ok {
+			want = length
+		}
+		if len(f.Content) != want {
+			t.Errorf("frame %v has %v bytes, want %v", f.SeqNr, len(f.Content), want)
+		}
+		next++
+	}
+	for dropped[next] {
+		next++
+	}
+	if next != n {
+		t.Errorf("frames after %v missing", next)
+	}
+}
+
+func TestNewLossyFrameWriterRejectsInvalidProbabilities(t *testing.T) {
+	for _, p := range [][2]float64{{-0.1, 0}, {1.1, 0}, {0, -0.1}, {0, 1.1}} {
+		if _, err := NewLossyFrameWriter(newChanWriter(), p[0], p[1], 1); err == nil {
+			t.Errorf("expected error for probabilities %v", p)
+		}
+	}
+}
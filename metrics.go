@@ -0,0 +1,19 @@
+package syncodec
+
+import "time"
+
+// Collector receives observations about the output of a codec, e.g. to export
+// them as metrics. Implementations must be safe for concurrent use.
+type Collector interface {
+	// ObserveFrame is called for every frame written by the codec.
+	ObserveFrame(size int, duration time.Duration)
+
+	// ObserveBitrateUpdate is called whenever the target bitrate changes.
+	ObserveBitrateUpdate(bps int)
+}
+
+type nopCollector struct{}
+
+func (nopCollector) ObserveFrame(int, time.Duration) {}
+
+func (nopCollector) ObserveBitrateUpdate(int) {}
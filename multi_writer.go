@@ -0,0 +1,53 @@
+package syncodec
+
+import "strings"
+
+var _ FrameWriter = (*multiFrameWriter)(nil)
+
+// multiWriteError combines the errors returned by the writers of a
+// MultiFrameWriter.
+type multiWriteError []error
+
+func (e multiWriteError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+type multiFrameWriter struct {
+	writers []FrameWriter
+}
+
+// WriteFrame writes f to all writers in order, even if some of them fail. If
+// exactly one writer fails, WriteFrame returns its error, if several writers
+// fail, it returns an error combining their errors.
+func (m *multiFrameWriter) WriteFrame(f Frame) error {
+	var errs multiWriteError
+	for _, w := range m.writers {
+		if err := w.WriteFrame(f); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return errs
+	}
+}
+
+// MultiFrameWriter returns a FrameWriter which duplicates each frame to all
+// given writers, similar to io.MultiWriter. Frames are written synchronously
+// and in the order the writers are given. All writers share the content of
+// the frame, so writers must not modify it.
+func MultiFrameWriter(writers ...FrameWriter) FrameWriter {
+	all := make([]FrameWriter, len(writers))
+	copy(all, writers)
+	return &multiFrameWriter{
+		writers: all,
+	}
+}
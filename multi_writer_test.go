@@ -0,0 +1,43 @@
+package syncodec
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMultiFrameWriterDuplicatesFrames(t *testing.T) {
+	a := &RecordingFrameWriter{}
+	b := &RecordingFrameWriter{}
+	w := MultiFrameWriter(a, b)
+	for i := uint64(0); i < 5; i++ {
+		if err := w.WriteFrame(Frame{SeqNr: i, Content: make([]byte, i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	framesA, framesB := a.Frames(), b.Frames()
+	if len(framesA) != 5 || len(framesB) != 5 {
+		t.Fatalf("writers received %v and %v frames, want 5", len(framesA), len(framesB))
+	}
+	for i := range framesA {
+		if framesA[i].SeqNr != uint64(i) || framesB[i].SeqNr != uint64(i) {
+			t.Errorf("frame %v received as %v and %v", i, framesA[i].SeqNr, framesB[i].SeqNr)
+		}
+	}
+}
+
+func TestMultiFrameWriterCombinesErrors(t *testing.T) {
+	errA := errors.New("a failed")
+	errB := errors.New("b failed")
+	rec := &RecordingFrameWriter{}
+
+	if err := MultiFrameWriter(errWriter{errA}, rec).WriteFrame(Frame{}); err != errA {
+		t.Errorf("single failure returned %v, want %v", err, errA)
+	}
+	if len(rec.Frames()) != 1 {
+		t.Error("frame not written after failing writer")
+	}
+	err := MultiFrameWriter(errWriter{errA}, rec, errWriter{errB}).WriteFrame(Frame{})
+	if err == nil || err.Error() != "a failed; b failed" {
+		t.Errorf("combined error %v, want a failed; b failed", err)
+	}
+}
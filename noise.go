@@ -0,0 +1,118 @@
+package syncodec
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+)
+
+// Noiser generates samples of a random variable which are used to perturb the
+// normalized size and interval of generated frames. How a sample scales a value
+// is determined by a NoiseSign.
+type Noiser interface {
+	Noise() float64
+}
+
+// NoiseSign determines how a noise sample scales the value it perturbs.
+type NoiseSign int
+
+const (
+	// NoiseSubtract scales values by 1 - noise, i.e. positive noise shrinks
+	// the value. This is the default.
+	NoiseSubtract NoiseSign = iota
+
+	// NoiseAdd scales values by 1 + noise, i.e. positive noise grows the
+	// value.
+	NoiseAdd
+)
+
+// factor returns the factor by which the noise sample n scales a value.
+func (s NoiseSign) factor(n float64) float64 {
+	if s == NoiseAdd {
+		return 1 + n
+	}
+	return 1 - n
+}
+
+type laplaceNoise struct {
+	rnd   *rand.Rand
+	scale float64
+}
+
+// NewLaplaceNoiser returns a Noiser drawing samples from a zero-mean laplacian
+// distribution with the given scale parameter.
+func NewLaplaceNoiser(scale float64, src rand.Source) Noiser {
+	return laplaceNoise{
+		rnd:   rand.New(src),
+		scale: scale,
+	}
+}
+
+func (l laplaceNoise) Noise() float64 {
+	e1 := -l.scale * math.Log(l.rnd.Float64())
+	e2 := -l.scale * math.Log(l.rnd.Float64())
+	return e1 - e2
+}
+
+type gaussianNoise struct {
+	rnd    *rand.Rand
+	mean   float64
+	stdDev float64
+}
+
+// NewGaussianNoiser returns a Noiser drawing samples from a normal
+// distribution with the given mean and standard deviation. It returns an error
+// if stdDev is negative.
+func NewGaussianNoiser(mean, stdDev float64, src rand.Source) (Noiser, error) {
+	if stdDev < 0 {
+		return nil, errors.New("standard deviation must not be negative")
+	}
+	return gaussianNoise{
+		rnd:    rand.New(src),
+		mean:   mean,
+		stdDev: stdDev,
+	}, nil
+}
+
+func (g gaussianNoise) Noise() float64 {
+	return g.mean + g.stdDev*g.rnd.NormFloat64()
+}
+
+type paretoNoise struct {
+	rnd   *rand.Rand
+	shape float64
+	scale float64
+}
+
+// NewParetoNoiser returns a Noiser based on a heavy-tailed pareto distribution
+// with the given shape and scale parameters. Shape must be greater than 1 and
+// scale must be positive, otherwise NewParetoNoiser returns an error. The
+// noise is the negated deviation of a pareto sample from the mean of the
+// distribution. Since codecs scale frame sizes by 1 - noise by default, using
+// it as frame size noise produces mostly average frames and rare frames that
+// are several times larger than average.
+func NewParetoNoiser(shape, scale float64, src rand.Source) (Noiser, error) {
+	if shape <= 1 {
+		return nil, errors.New("pareto shape must be greater than 1")
+	}
+	if scale <= 0 {
+		return nil, errors.New("pareto scale must be positive")
+	}
+	return paretoNoise{
+		rnd:   rand.New(src),
+		shape: shape,
+		scale: scale,
+	}, nil
+}
+
+func (p paretoNoise) Noise() float64 {
+	mean := p.shape * p.scale / (p.shape - 1)
+	sample := p.scale / math.Pow(1-p.rnd.Float64(), 1/p.shape)
+	return mean - sample
+}
+
+type zeroNoise struct{}
+
+func (zeroNoise) Noise() float64 {
+	return 0
+}
@@ -0,0 +1,249 @@
+package syncodec
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// sampleMoments returns the empirical mean and variance of n samples of
+// noiser.
+func sampleMoments(noiser Noiser, n int) (float64, float64) {
+	sum, sumSquares := 0.0, 0.0
+	for i := 0; i < n; i++ {
+		x := noiser.Noise()
+		sum += x
+		sumSquares += x * x
+	}
+	mean := sum / float64(n)
+	return mean, sumSquares/float64(n) - mean*mean
+}
+
+// newGaussianNoiser returns a Gaussian Noiser and fails the test if the
+// parameters are rejected.
+func newGaussianNoiser(t *testing.T, mean, stdDev float64) Noiser {
+	t.Helper()
+	n, err := NewGaussianNoiser(mean, stdDev, rand.NewSource(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestGaussianNoiserMoments(t *testing.T) {
+	mean, variance := sampleMoments(newGaussianNoiser(t, 0.1, 0.2), 100_000)
+	if math.Abs(mean-0.1) > 0.005 {
+		t.Errorf("mean %v, want 0.1", mean)
+	}
+	if math.Abs(variance-0.04) > 0.002 {
+		t.Errorf("variance %v, want 0.04", variance)
+	}
+}
+
+func TestGaussianNoiserRejectsNegativeStdDev(t *testing.T) {
+	if _, err := NewGaussianNoiser(0, -0.1, rand.NewSource(1)); err == nil {
+		t.Error("expected error for negative standard deviation")
+	}
+}
+
+func TestStatisticalCodecUsesFrameSizeNoiser(t *testing.T) {
+	c, err := NewStatisticalEncoder(newChanWriter(), WithRandSeed(1), WithFrameSizeNoiser(newGaussianNoiser(t, 0.5, 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A constant noise of 0.5 halves the frame size.
+	want := defaultTargetBitrateBps / 8 / defaultFPS / 2
+	if f, _ := c.nextFrame(); len(f.Content) != want {
+		t.Errorf("frame has %v bytes, want %v", len(f.Content), want)
+	}
+}
+
+func TestLaplaceNoiserMoments(t *testing.T) {
+	mean, variance := sampleMoments(NewLaplaceNoiser(defaultScaleB, rand.NewSource(1)), 100_000)
+	if math.Abs(mean) > 0.005 {
+		t.Errorf("mean %v, want 0", mean)
+	}
+	if want := 2 * defaultScaleB * defaultScaleB; math.Abs(variance-want) > 0.05*want {
+		t.Errorf("variance %v, want %v", variance, want)
+	}
+}
+
+func TestParetoNoiserTail(t *testing.T) {
+	shape, scale := 2.5, 0.4
+	noiser, err := NewParetoNoiser(shape, scale, rand.NewSource(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mean := shape * scale / (shape - 1)
+	n := 200_000
+	samples := make([]float64, n)
+	for i := range samples {
+		samples[i] = mean - noiser.Noise()
+	}
+	for _, x := range []float64{2 * scale, 4 * scale} {
+		exceed := 0
+		for _, s := range samples {
+			if s < scale {
+				t.Fatalf("sample %v below scale %v", s, scale)
+			}
+			if s > x {
+				exceed++
+			}
+		}
+		got := float64(exceed) / float64(n)
+		want := math.Pow(scale/x, shape)
+		if math.Abs(got-want) > 0.1*want {
+			t.Errorf("P(X > %v) = %v, want %v", x, got, want)
+		}
+	}
+}
+
+func TestParetoNoiserRejectsInvalidParameters(t *testing.T) {
+	for _, tc := range []struct {
+		shape, scale float64
+	}{
+		{1, 0.4},
+		{0.5, 0.4},
+		{2.5, 0},
+		{2.5, -0.4},
+	} {
+		if _, err := NewParetoNoiser(tc.shape, tc.scale, rand.NewSource(1)); err == nil {
+			t.Errorf("expected error for shape %v and scale %v", tc.shape, tc.scale)
+		}
+	}
+}
+
+func TestNoiseSignFactor(t *testing.T) {
+	if got := NoiseSubtract.factor(0.25); got != 0.75 {
+		t.Errorf("subtracted noise factor %v, want 0.75", got)
+	}
+	if got := NoiseAdd.factor(0.25); got != 1.25 {
+		t.Errorf("added noise factor %v, want 1.25", got)
+	}
+}
+
+func TestStatisticalCodecNoiseSigns(t *testing.T) {
+	constant := func(n float64) Noiser {
+		return newGaussianNoiser(t, n, 0)
+	}
+	bytesPerFrame := float64(defaultTargetBitrateBps / 8 / defaultFPS)
+	nominal := float64(time.Second / defaultFPS)
+	for _, tc := range []struct {
+		name           string
+		sizeSign       NoiseSign
+		durationSign   NoiseSign
+		sizeFactor     float64
+		durationFactor float64
+	}{
+		{"default", NoiseSubtract, NoiseSubtract, 0.5, 0.5},
+		{"added size noise", NoiseAdd, NoiseSubtract, 1.5, 0.5},
+		{"added duration noise", NoiseSubtract, NoiseAdd, 0.5, 1.5},
+	} {
+		c, err := NewStatisticalEncoder(newChanWriter(),
+			WithFrameSizeNoiser(constant(0.5)),
+			WithFrameDurationNoiser(constant(0.5)),
+			WithSizeNoiseSign(tc.sizeSign),
+			WithDurationNoiseSign(tc.durationSign),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, _ := c.nextFrame()
+		if want := int(bytesPerFrame * tc.sizeFactor); len(f.Content) != want {
+			t.Errorf("%v: frame has %v bytes, want %v", tc.name, len(f.Content), want)
+		}
+		if want := time.Duration(nominal * tc.durationFactor); f.Duration != want {
+			t.Errorf("%v: frame has duration %v, want %v", tc.name, f.Duration, want)
+		}
+	}
+
+	if _, err := NewStatisticalEncoder(newChanWriter(), WithSizeNoiseSign(NoiseSign(7))); err == nil {
+		t.Error("expected error for unknown noise sign")
+	}
+}
+
+func TestStatisticalCodecClampsNegativeDurationNoiseFactor(t *testing.T) {
+	c, err := NewStatisticalEncoder(newChanWriter(),
+		WithFrameDurationNoiser(newGaussianNoiser(t, 2, 0)),
+		WithStrictBounds(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f, _ := c.nextFrame(); f.Duration != 0 {
+		t.Errorf("frame has duration %v with a noise of 2, want 0", f.Duration)
+	}
+	select {
+	case err := <-c.Errors():
+		var boundsErr *BoundsError
+		if !errors.As(err, &boundsErr) || boundsErr.Quantity != "frame duration noise factor" || boundsErr.Value != -1 {
+			t.Errorf("unexpected error %v", err)
+		}
+	default:
+		t.Error("clamped noise factor not reported")
+	}
+}
+
+// correlation returns the Pearson correlation of n samples drawn alternately
+// from a and b.
+func correlation(a, b Noiser, n int) float64 {
+	var sumA, sumB, sumAA, sumBB, sumAB float64
+	for i := 0; i < n; i++ {
+		x, y := a.Noise(), b.Noise()
+		sumA += x
+		sumB += y
+		sumAA += x * x
+		sumBB += y * y
+		sumAB += x * y
+	}
+	meanA, meanB := sumA/float64(n), sumB/float64(n)
+	cov := sumAB/float64(n) - meanA*meanB
+	return cov / math.Sqrt((sumAA/float64(n)-meanA*meanA)*(sumBB/float64(n)-meanB*meanB))
+}
+
+func TestStatisticalCodecNoiseStreamsAreUncorrelated(t *testing.T) {
+	c, err := NewStatisticalEncoder(newChanWriter(), WithRandSeed(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := correlation(c.frameSizeNoiser, c.frameDurationNoiser, 50_000); math.Abs(r) > 0.02 {
+		t.Errorf("correlation of size and duration noise %v, want 0", r)
+	}
+
+	// Identical seeds yield identical streams, which shows that the seed
+	// options control the streams.
+	same, err := NewStatisticalEncoder(newChanWriter(), WithSizeNoiseSeed(5), WithDurationNoiseSeed(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := correlation(same.frameSizeNoiser, same.frameDurationNoiser, 1000); r < 0.999 {
+		t.Errorf("correlation of noise streams with the same seed %v, want 1", r)
+	}
+}
+
+func TestStatisticalCodecSizeNoiseSeedKeepsDurations(t *testing.T) {
+	sequence := func(opts ...StatisticalCodecOption) ([]int, []time.Duration) {
+		c, err := NewStatisticalEncoder(newChanWriter(), append([]StatisticalCodecOption{WithRandSeed(1)}, opts...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes, durations := []int{}, []time.Duration{}
+		for i := 0; i < 20; i++ {
+			f, _ := c.nextFrame()
+			sizes = append(sizes, len(f.Content))
+			durations = append(durations, f.Duration)
+		}
+		return sizes, durations
+	}
+	sizes, durations := sequence()
+	otherSizes, otherDurations := sequence(WithSizeNoiseSeed(99))
+	if fmt.Sprint(otherDurations) != fmt.Sprint(durations) {
+		t.Error("size noise seed changed frame durations")
+	}
+	if fmt.Sprint(otherSizes) == fmt.Sprint(sizes) {
+		t.Error("size noise seed did not change frame sizes")
+	}
+}
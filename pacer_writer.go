@@ -0,0 +1,164 @@
+package syncodec
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// pacerInterval is the interval at which a PacerFrameWriter refills its token
+// bucket and releases bytes.
+const pacerInterval = 5 * time.Millisecond
+
+var _ FrameWriter = (*PacerFrameWriter)(nil)
+
+// PacerFrameWriter models a transport pacer in front of a codec. It queues
+// written frames and releases their bytes to another FrameWriter at a
+// configured rate using a token bucket. Frames larger than the available
+// tokens are split into multiple partial frames, which carry the metadata of
+// the original frame and a part of its content. All partial frames except the
+// last one have a duration of zero, such that the durations of the released
+// frames add up to the durations of the written frames.
+type PacerFrameWriter struct {
+	writer FrameWriter
+
+	// bytes added to the token bucket per pacerInterval
+	bytesPerInterval int
+
+	// capacity of the token bucket in bytes
+	burstBytes int
+
+	clock Clock
+
+	lock   sync.Mutex
+	queue  []Frame
+	notify chan struct{}
+	err    error
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewPacerFrameWriter returns a PacerFrameWriter releasing bytes to w at
+// rateBps bits per second and at most burstBytes at once. The rate must allow
+// releasing at least one byte per pacing interval of 5ms.
+func NewPacerFrameWriter(w FrameWriter, rateBps, burstBytes int) (*PacerFrameWriter, error) {
+	return newPacerFrameWriter(w, rateBps, burstBytes, realClock{})
+}
+
+func newPacerFrameWriter(w FrameWriter, rateBps, burstBytes int, clock Clock) (*PacerFrameWriter, error) {
+	if w == nil {
+		return nil, errors.New("writer must not be nil")
+	}
+	if rateBps <= 0 {
+		return nil, errors.New("pacing rate must be positive")
+	}
+	if burstBytes <= 0 {
+		return nil, errors.New("pacer burst size must be positive")
+	}
+	bytesPerInterval := int(float64(rateBps) * pacerInterval.Seconds() / 8)
+	if bytesPerInterval == 0 {
+		return nil, fmt.Errorf("pacing rate %v bps releases less than one byte per %v", rateBps, pacerInterval)
+	}
+	p := &PacerFrameWriter{
+		writer:           w,
+		bytesPerInterval: bytesPerInterval,
+		burstBytes:       burstBytes,
+		clock:            clock,
+		lock:             sync.Mutex{},
+		queue:            []Frame{},
+		notify:           make(chan struct{}, 1),
+		err:              nil,
+		done:             make(chan struct{}),
+	}
+	go p.run()
+	return p, nil
+}
+
+// WriteFrame queues f for pacing. WriteFrame never blocks. Since frames are
+// written to the wrapped FrameWriter asynchronously, WriteFrame returns the
+// first error the wrapped FrameWriter returned for an earlier frame, if any.
+func (p *PacerFrameWriter) WriteFrame(f Frame) error {
+	p.lock.Lock()
+	p.queue = append(p.queue, f)
+	err := p.err
+	p.lock.Unlock()
+
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+	return err
+}
+
+func (p *PacerFrameWriter) run() {
+	timer := p.clock.NewTimer(pacerInterval)
+	defer timer.Stop()
+	deadline := p.clock.Now().Add(pacerInterval)
+
+	tokens := p.burstBytes
+	for {
+		select {
+		case <-timer.C():
+			tokens = min(tokens+p.bytesPerInterval, p.burstBytes)
+			deadline = deadline.Add(pacerInterval)
+			timer.Reset(deadline.Sub(p.clock.Now()))
+		case <-p.notify:
+		case <-p.done:
+			return
+		}
+		for tokens > 0 {
+			f, ok := p.release(tokens)
+			if !ok {
+				break
+			}
+			tokens -= len(f.Content)
+			if err := p.writer.WriteFrame(f); err != nil {
+				p.lock.Lock()
+				if p.err == nil {
+					p.err = err
+				}
+				p.lock.Unlock()
+			}
+		}
+	}
+}
+
+// release removes up to n bytes from the head of the queue and returns them
+// as a (partial) frame.
+func (p *PacerFrameWriter) release(n int) (Frame, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if len(p.queue) == 0 {
+		return Frame{}, false
+	}
+	head := p.queue[0]
+	if len(head.Content) <= n {
+		p.queue = p.queue[1:]
+		return head, true
+	}
+	part := head
+	part.Content = head.Content[:n]
+	part.Duration = 0
+	p.queue[0].Content = head.Content[n:]
+	return part, true
+}
+
+// Err returns the first error the wrapped FrameWriter returned.
+func (p *PacerFrameWriter) Err() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.err
+}
+
+// Close stops the pacer. Queued frames are discarded. Calling Close more than
+// once has no effect.
+func (p *PacerFrameWriter) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.done)
+	})
+	return nil
+}
@@ -0,0 +1,63 @@
+package syncodec
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPacerFrameWriterSplitsLargeFrame(t *testing.T) {
+	clock := newFakeClock()
+	w := newChanWriter()
+	// 500 bytes per pacing interval
+	p, err := newPacerFrameWriter(w, 800_000, 1000, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	clock.BlockUntil(1)
+
+	if err := p.WriteFrame(Frame{Content: make([]byte, 5000), Duration: 33 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	if f := receiveFrame(t, w); len(f.Content) != 1000 || f.Duration != 0 {
+		t.Errorf("first part has %v bytes and duration %v, want 1000 bytes and duration 0", len(f.Content), f.Duration)
+	}
+	expectNoFrame(t, w)
+
+	released := 1000
+	intervals := 0
+	for released < 5000 {
+		clock.BlockUntil(1)
+		clock.Step()
+		intervals++
+		f := receiveFrame(t, w)
+		if len(f.Content) != 500 {
+			t.Errorf("part %v has %v bytes, want 500", intervals, len(f.Content))
+		}
+		released += len(f.Content)
+		if released < 5000 && f.Duration != 0 {
+			t.Errorf("partial frame has duration %v", f.Duration)
+		}
+		if released == 5000 && f.Duration != 33*time.Millisecond {
+			t.Errorf("last part has duration %v, want 33ms", f.Duration)
+		}
+	}
+	if intervals != 8 {
+		t.Errorf("frame released over %v intervals, want 8", intervals)
+	}
+}
+
+func TestNewPacerFrameWriterValidatesArguments(t *testing.T) {
+	for _, tc := range []struct {
+		name                string
+		rateBps, burstBytes int
+	}{
+		{"zero rate", 0, 1000},
+		{"negative burst", 800_000, -1},
+		{"rate below one byte per interval", 1000, 1000},
+	} {
+		if _, err := NewPacerFrameWriter(newChanWriter(), tc.rateBps, tc.burstBytes); err == nil {
+			t.Errorf("%v accepted", tc.name)
+		}
+	}
+}
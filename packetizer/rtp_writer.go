@@ -0,0 +1,138 @@
+// Package packetizer splits frames generated by syncodec codecs into RTP
+// packets.
+package packetizer
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/mengelbart/syncodec"
+	"github.com/pion/rtp"
+)
+
+const (
+	// rtpHeaderSize is the size of an RTP header without CSRCs and
+	// extensions.
+	rtpHeaderSize = 12
+
+	defaultMTU       = 1200
+	defaultClockRate = 90_000
+)
+
+var _ syncodec.FrameWriter = (*RTPFrameWriter)(nil)
+
+// RTPWriter is the interface implemented by consumers of RTP packets, e.g.
+// pion/webrtc's TrackLocalStaticRTP.
+type RTPWriter interface {
+	WriteRTP(*rtp.Packet) error
+}
+
+// Config configures an RTPFrameWriter.
+type Config struct {
+	// MTU is the maximum size of an RTP packet including the RTP header.
+	// Defaults to 1200 bytes.
+	MTU int
+
+	// PayloadType is the RTP payload type of all packets.
+	PayloadType uint8
+
+	// SSRC is the synchronization source of all packets.
+	SSRC uint32
+
+	// ClockRate is the RTP clock rate used to derive timestamps from the
+	// presentation timestamps of frames. Defaults to 90 kHz.
+	ClockRate uint32
+
+	// InitialSequenceNumber is the sequence number of the first packet.
+	InitialSequenceNumber uint16
+
+	// InitialTimestamp is the RTP timestamp of a frame with PTS 0.
+	InitialTimestamp uint32
+}
+
+// RTPFrameWriter is a syncodec.FrameWriter which fragments the content of each
+// frame into RTP packets of at most MTU bytes and writes them to an
+// RTPWriter. All packets of a frame share a timestamp derived from the PTS of
+// the frame and the marker bit is set on the last packet of each frame.
+type RTPFrameWriter struct {
+	writer RTPWriter
+	config Config
+
+	lock           sync.Mutex
+	sequenceNumber uint16
+	err            error
+}
+
+func NewRTPFrameWriter(w RTPWriter, config Config) (*RTPFrameWriter, error) {
+	if config.MTU == 0 {
+		config.MTU = defaultMTU
+	}
+	if config.ClockRate == 0 {
+		config.ClockRate = defaultClockRate
+	}
+	if config.MTU <= rtpHeaderSize {
+		return nil, errors.New("MTU too small to fit RTP header")
+	}
+	return &RTPFrameWriter{
+		writer:         w,
+		config:         config,
+		sequenceNumber: config.InitialSequenceNumber,
+	}, nil
+}
+
+// WriteFrame packetizes f and writes the packets to the RTPWriter. Frames
+// without content result in a single packet with an empty payload. After a
+// write failed, all subsequent frames are discarded and WriteFrame and Err
+// return the error.
+func (w *RTPFrameWriter) WriteFrame(f syncodec.Frame) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+	maxPayload := w.config.MTU - rtpHeaderSize
+	timestamp := w.config.InitialTimestamp + clockTicks(f.PTS, w.config.ClockRate)
+	content := f.Content
+	for {
+		n := len(content)
+		if n > maxPayload {
+			n = maxPayload
+		}
+		packet := &rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				Marker:         n == len(content),
+				PayloadType:    w.config.PayloadType,
+				SequenceNumber: w.sequenceNumber,
+				Timestamp:      timestamp,
+				SSRC:           w.config.SSRC,
+			},
+			Payload: content[:n],
+		}
+		w.sequenceNumber++
+		if err := w.writer.WriteRTP(packet); err != nil {
+			w.err = err
+			return err
+		}
+		content = content[n:]
+		if len(content) == 0 {
+			return nil
+		}
+	}
+}
+
+// Err returns the first error returned by the RTPWriter.
+func (w *RTPFrameWriter) Err() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.err
+}
+
+// clockTicks converts d to ticks of an RTP clock with the given rate. The
+// result wraps around like RTP timestamps do.
+func clockTicks(d time.Duration, rate uint32) uint32 {
+	return uint32(uint64(d.Seconds() * float64(rate)))
+}
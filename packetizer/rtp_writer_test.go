@@ -0,0 +1,113 @@
+package packetizer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mengelbart/syncodec"
+	"github.com/pion/rtp"
+)
+
+// packetRecorder is an RTPWriter which records all packets.
+type packetRecorder struct {
+	packets []*rtp.Packet
+	err     error
+}
+
+func (r *packetRecorder) WriteRTP(p *rtp.Packet) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.packets = append(r.packets, p)
+	return nil
+}
+
+func TestRTPFrameWriterFragmentsFrames(t *testing.T) {
+	const mtu = 100
+	maxPayload := mtu - rtpHeaderSize
+	rec := &packetRecorder{}
+	w, err := NewRTPFrameWriter(rec, Config{
+		MTU:                   mtu,
+		PayloadType:           96,
+		SSRC:                  1234,
+		InitialSequenceNumber: 65534,
+		InitialTimestamp:      1000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sizes := []int{0, maxPayload, maxPayload + 1, 3*maxPayload + 10}
+	packetCounts := []int{1, 1, 2, 4}
+	for i, size := range sizes {
+		f := syncodec.Frame{
+			Content: make([]byte, size),
+			PTS:     time.Duration(i) * 40 * time.Millisecond,
+		}
+		if err := w.WriteFrame(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	seqNr := uint16(65534)
+	next := 0
+	for i, count := range packetCounts {
+		packets := rec.packets[next : next+count]
+		next += count
+		payload := 0
+		for j, p := range packets {
+			if p.SequenceNumber != seqNr {
+				t.Errorf("packet %v of frame %v has sequence number %v, want %v", j, i, p.SequenceNumber, seqNr)
+			}
+			seqNr++
+			if want := j == count-1; p.Marker != want {
+				t.Errorf("packet %v of frame %v has marker %v, want %v", j, i, p.Marker, want)
+			}
+			if want := uint32(1000 + i*3600); p.Timestamp != want {
+				t.Errorf("packet %v of frame %v has timestamp %v, want %v", j, i, p.Timestamp, want)
+			}
+			if p.PayloadType != 96 || p.SSRC != 1234 {
+				t.Errorf("packet %v of frame %v has payload type %v and SSRC %v", j, i, p.PayloadType, p.SSRC)
+			}
+			if len(p.Payload) > maxPayload {
+				t.Errorf("packet %v of frame %v has %v payload bytes, want at most %v", j, i, len(p.Payload), maxPayload)
+			}
+			payload += len(p.Payload)
+		}
+		if payload != sizes[i] {
+			t.Errorf("frame %v packetized into %v payload bytes, want %v", i, payload, sizes[i])
+		}
+	}
+	if next != len(rec.packets) {
+		t.Errorf("%v packets written, want %v", len(rec.packets), next)
+	}
+}
+
+func TestRTPFrameWriterKeepsFirstError(t *testing.T) {
+	writeErr := errors.New("write failed")
+	rec := &packetRecorder{err: writeErr}
+	w, err := NewRTPFrameWriter(rec, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFrame(syncodec.Frame{Content: make([]byte, 10)}); err != writeErr {
+		t.Fatalf("WriteFrame returned %v, want %v", err, writeErr)
+	}
+	rec.err = nil
+	if err := w.WriteFrame(syncodec.Frame{Content: make([]byte, 10)}); err != writeErr {
+		t.Errorf("WriteFrame after failure returned %v, want %v", err, writeErr)
+	}
+	if w.Err() != writeErr {
+		t.Errorf("Err returned %v, want %v", w.Err(), writeErr)
+	}
+	if len(rec.packets) != 0 {
+		t.Errorf("%v packets written after failure", len(rec.packets))
+	}
+}
+
+func TestNewRTPFrameWriterRejectsSmallMTU(t *testing.T) {
+	if _, err := NewRTPFrameWriter(&packetRecorder{}, Config{MTU: rtpHeaderSize}); err == nil {
+		t.Error("expected error for MTU without room for payload")
+	}
+}
@@ -0,0 +1,192 @@
+// Package pcap writes RTP packets generated from syncodec frames to pcap
+// files for offline analysis, e.g. with Wireshark.
+package pcap
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mengelbart/syncodec/packetizer"
+	"github.com/pion/rtp"
+)
+
+const (
+	// magic number of pcap files with microsecond timestamps
+	pcapMagic = 0xa1b2c3d4
+
+	// link type of raw IPv4 and IPv6 packets without link layer header
+	linkTypeRaw = 101
+
+	maxSnapLen = 65535
+
+	pcapHeaderSize   = 24
+	recordHeaderSize = 16
+	ipv4HeaderSize   = 20
+	udpHeaderSize    = 8
+
+	defaultClockRate = 90_000
+	defaultSrcPort   = 5000
+	defaultDstPort   = 5004
+)
+
+var _ packetizer.RTPWriter = (*Writer)(nil)
+
+// Config configures the synthetic network headers and timestamps of a Writer.
+type Config struct {
+	// SrcIP and DstIP are the IPv4 addresses of the synthetic IP header.
+	// Default to 10.0.0.1 and 10.0.0.2.
+	SrcIP net.IP
+	DstIP net.IP
+
+	// SrcPort and DstPort are the ports of the synthetic UDP header. Default
+	// to 5000 and 5004.
+	SrcPort uint16
+	DstPort uint16
+
+	// ClockRate is the RTP clock rate used to derive capture timestamps from
+	// RTP timestamps. It must match the clock rate of the packetizer.
+	// Defaults to 90 kHz.
+	ClockRate uint32
+
+	// StartTime is the capture timestamp of the first packet. Defaults to the
+	// time the Writer is created.
+	StartTime time.Time
+}
+
+// Writer is a packetizer.RTPWriter which writes RTP packets to a pcap stream
+// of raw IPv4 packets with synthetic IP and UDP headers. The capture timestamp
+// of each packet is derived from its RTP timestamp relative to the first
+// packet, i.e. from the PTS of the frame the packet belongs to.
+type Writer struct {
+	config Config
+
+	lock           sync.Mutex
+	writer         io.Writer
+	ipID           uint16
+	firstTimestamp uint32
+	started        bool
+}
+
+// NewWriter returns a Writer writing to w. It writes the pcap file header
+// immediately and returns an error if that fails.
+func NewWriter(w io.Writer, config Config) (*Writer, error) {
+	if config.SrcIP == nil {
+		config.SrcIP = net.IPv4(10, 0, 0, 1)
+	}
+	if config.DstIP == nil {
+		config.DstIP = net.IPv4(10, 0, 0, 2)
+	}
+	if config.SrcIP.To4() == nil || config.DstIP.To4() == nil {
+		return nil, errors.New("pcap writer requires IPv4 addresses")
+	}
+	if config.SrcPort == 0 {
+		config.SrcPort = defaultSrcPort
+	}
+	if config.DstPort == 0 {
+		config.DstPort = defaultDstPort
+	}
+	if config.ClockRate == 0 {
+		config.ClockRate = defaultClockRate
+	}
+	if config.StartTime.IsZero() {
+		config.StartTime = time.Now()
+	}
+
+	var header [pcapHeaderSize]byte
+	binary.LittleEndian.PutUint32(header[0:], pcapMagic)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], maxSnapLen)
+	binary.LittleEndian.PutUint32(header[20:], linkTypeRaw)
+	if _, err := w.Write(header[:]); err != nil {
+		return nil, err
+	}
+	return &Writer{
+		config: config,
+		writer: w,
+	}, nil
+}
+
+// NewPCAPFrameWriter returns a syncodec.FrameWriter which packetizes frames
+// according to rtpConfig and writes the packets to w as pcap using a Writer.
+// The clock rate of config defaults to the clock rate of rtpConfig.
+func NewPCAPFrameWriter(w io.Writer, config Config, rtpConfig packetizer.Config) (*packetizer.RTPFrameWriter, error) {
+	if config.ClockRate == 0 {
+		config.ClockRate = rtpConfig.ClockRate
+	}
+	pw, err := NewWriter(w, config)
+	if err != nil {
+		return nil, err
+	}
+	return packetizer.NewRTPFrameWriter(pw, rtpConfig)
+}
+
+// WriteRTP writes p as a UDP datagram to the pcap stream.
+func (w *Writer) WriteRTP(p *rtp.Packet) error {
+	payload, err := p.Marshal()
+	if err != nil {
+		return err
+	}
+	size := ipv4HeaderSize + udpHeaderSize + len(payload)
+	if size > maxSnapLen {
+		return errors.New("RTP packet too large for IPv4")
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if !w.started {
+		w.firstTimestamp = p.Timestamp
+		w.started = true
+	}
+	ticks := p.Timestamp - w.firstTimestamp
+	offset := time.Duration(float64(ticks) / float64(w.config.ClockRate) * float64(time.Second))
+	ts := w.config.StartTime.Add(offset)
+
+	buf := make([]byte, recordHeaderSize+size)
+	binary.LittleEndian.PutUint32(buf[0:], uint32(ts.Unix()))
+	binary.LittleEndian.PutUint32(buf[4:], uint32(ts.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(buf[8:], uint32(size))
+	binary.LittleEndian.PutUint32(buf[12:], uint32(size))
+
+	ip := buf[recordHeaderSize:]
+	ip[0] = 0x45 // version 4, header length 5 words
+	binary.BigEndian.PutUint16(ip[2:], uint16(size))
+	binary.BigEndian.PutUint16(ip[4:], w.ipID)
+	binary.BigEndian.PutUint16(ip[6:], 0x4000) // don't fragment
+	ip[8] = 64                                 // TTL
+	ip[9] = 17                                 // UDP
+	copy(ip[12:16], w.config.SrcIP.To4())
+	copy(ip[16:20], w.config.DstIP.To4())
+	binary.BigEndian.PutUint16(ip[10:], checksum(ip[:ipv4HeaderSize]))
+	w.ipID++
+
+	udp := ip[ipv4HeaderSize:]
+	binary.BigEndian.PutUint16(udp[0:], w.config.SrcPort)
+	binary.BigEndian.PutUint16(udp[2:], w.config.DstPort)
+	binary.BigEndian.PutUint16(udp[4:], uint16(udpHeaderSize+len(payload)))
+	// A UDP checksum of zero means no checksum in IPv4.
+	copy(udp[udpHeaderSize:], payload)
+
+	_, err = w.writer.Write(buf)
+	return err
+}
+
+// checksum returns the internet checksum of b as defined in RFC 1071.
+func checksum(b []byte) uint16 {
+	sum := uint32(0)
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(b[i:]))
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+	return ^uint16(sum)
+}
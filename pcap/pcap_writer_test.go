@@ -0,0 +1,118 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/mengelbart/syncodec"
+	"github.com/mengelbart/syncodec/packetizer"
+	"github.com/pion/rtp"
+)
+
+// record is a packet read from a pcap stream.
+type record struct {
+	ts     time.Time
+	packet []byte
+}
+
+// readPCAP parses the pcap stream b written by a Writer.
+func readPCAP(t *testing.T, b []byte) []record {
+	t.Helper()
+	if len(b) < pcapHeaderSize {
+		t.Fatalf("pcap of %v bytes has no file header", len(b))
+	}
+	if magic := binary.LittleEndian.Uint32(b); magic != pcapMagic {
+		t.Fatalf("magic number %x, want %x", magic, pcapMagic)
+	}
+	if linkType := binary.LittleEndian.Uint32(b[20:]); linkType != linkTypeRaw {
+		t.Fatalf("link type %v, want %v", linkType, linkTypeRaw)
+	}
+	b = b[pcapHeaderSize:]
+	records := []record{}
+	for len(b) > 0 {
+		if len(b) < recordHeaderSize {
+			t.Fatalf("truncated record header of %v bytes", len(b))
+		}
+		sec := binary.LittleEndian.Uint32(b[0:])
+		usec := binary.LittleEndian.Uint32(b[4:])
+		capLen := binary.LittleEndian.Uint32(b[8:])
+		origLen := binary.LittleEndian.Uint32(b[12:])
+		if capLen != origLen {
+			t.Fatalf("record captured %v of %v bytes", capLen, origLen)
+		}
+		b = b[recordHeaderSize:]
+		if uint32(len(b)) < capLen {
+			t.Fatalf("truncated record of %v bytes, want %v", len(b), capLen)
+		}
+		records = append(records, record{
+			ts:     time.Unix(int64(sec), int64(usec)*1000),
+			packet: b[:capLen],
+		})
+		b = b[capLen:]
+	}
+	return records
+}
+
+func TestPCAPFrameWriter(t *testing.T) {
+	const mtu = 500
+	start := time.Unix(1_600_000_000, 0)
+	var buf bytes.Buffer
+	w, err := NewPCAPFrameWriter(&buf, Config{StartTime: start}, packetizer.Config{MTU: mtu, PayloadType: 96, SSRC: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizes := []int{100, 1000, 488, 2000}
+	wantPackets := []int{1, 3, 1, 5}
+	for i, size := range sizes {
+		f := syncodec.Frame{Content: make([]byte, size), PTS: time.Duration(i) * 40 * time.Millisecond}
+		if err := w.WriteFrame(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records := readPCAP(t, buf.Bytes())
+	total := 0
+	for _, n := range wantPackets {
+		total += n
+	}
+	if len(records) != total {
+		t.Fatalf("pcap has %v packets, want %v", len(records), total)
+	}
+	next := 0
+	for i, n := range wantPackets {
+		payload := 0
+		for _, r := range records[next : next+n] {
+			ip := r.packet
+			if ip[0] != 0x45 || ip[9] != 17 {
+				t.Fatalf("packet is not IPv4 UDP: version and length %x, protocol %v", ip[0], ip[9])
+			}
+			if int(binary.BigEndian.Uint16(ip[2:])) != len(ip) {
+				t.Errorf("IP total length %v, want %v", binary.BigEndian.Uint16(ip[2:]), len(ip))
+			}
+			if checksum(ip[:ipv4HeaderSize]) != 0 {
+				t.Error("invalid IP header checksum")
+			}
+			udp := ip[ipv4HeaderSize:]
+			if src, dst := binary.BigEndian.Uint16(udp[0:]), binary.BigEndian.Uint16(udp[2:]); src != defaultSrcPort || dst != defaultDstPort {
+				t.Errorf("UDP ports %v and %v, want %v and %v", src, dst, defaultSrcPort, defaultDstPort)
+			}
+			var p rtp.Packet
+			if err := p.Unmarshal(udp[udpHeaderSize:]); err != nil {
+				t.Fatalf("invalid RTP packet: %v", err)
+			}
+			if len(ip) > mtu+ipv4HeaderSize+udpHeaderSize {
+				t.Errorf("packet of %v bytes exceeds MTU", len(ip))
+			}
+			payload += len(p.Payload)
+			if want := start.Add(time.Duration(i) * 40 * time.Millisecond); !r.ts.Equal(want) {
+				t.Errorf("packet of frame %v captured at %v, want %v", i, r.ts, want)
+			}
+		}
+		if payload != sizes[i] {
+			t.Errorf("frame %v has %v payload bytes in pcap, want %v", i, payload, sizes[i])
+		}
+		next += n
+	}
+}
@@ -1,6 +1,7 @@
 package syncodec
 
 import (
+	"sync"
 	"time"
 )
 
@@ -9,10 +10,13 @@ var _ Codec = (*PerfectCodec)(nil)
 type PerfectCodec struct {
 	writer FrameWriter
 
+	fps int
+
+	lock             sync.Mutex
 	targetBitrateBps int
-	fps              int
 
-	done chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 func NewPerfectCodec(writer FrameWriter, targetBitrateBps int) *PerfectCodec {
@@ -26,23 +30,37 @@ func NewPerfectCodec(writer FrameWriter, targetBitrateBps int) *PerfectCodec {
 
 // GetTargetBitrate returns the current target bitrate in bit per second.
 func (c *PerfectCodec) GetTargetBitrate() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
 	return c.targetBitrateBps
 }
 
 // SetTargetBitrate sets the target bitrate to r bits per second.
 func (c *PerfectCodec) SetTargetBitrate(r int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
 	c.targetBitrateBps = r
 }
 
+// GetFPS returns the frame rate in frames per second.
+func (c *PerfectCodec) GetFPS() int {
+	return c.fps
+}
+
+// Start runs the PerfectCodec and writes frames to the FrameWriter until Close
+// is called. Start blocks, so it is usually run in its own goroutine. Errors
+// returned by the FrameWriter are ignored.
 func (c *PerfectCodec) Start() {
-	msToNextFrame := time.Duration((1.0/float64(c.fps))*1000.0) * time.Millisecond
-	ticker := time.NewTicker(msToNextFrame)
+	frameInterval := time.Duration(float64(time.Second) / float64(c.fps))
+	ticker := time.NewTicker(frameInterval)
 	for {
 		select {
 		case <-ticker.C:
 			c.writer.WriteFrame(Frame{
-				Content:  make([]byte, c.targetBitrateBps/(8.0*c.fps)),
-				Duration: msToNextFrame,
+				Content:  make([]byte, int64(c.GetTargetBitrate())/(8*int64(c.fps))),
+				Duration: frameInterval,
 			})
 		case <-c.done:
 			return
@@ -50,7 +68,10 @@ func (c *PerfectCodec) Start() {
 	}
 }
 
+// Close stops the PerfectCodec. Calling Close more than once has no effect.
 func (c *PerfectCodec) Close() error {
-	close(c.done)
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
 	return nil
 }
@@ -0,0 +1,32 @@
+package syncodec
+
+import "testing"
+
+func TestPerfectCodecSetTargetBitrateWhileRunning(t *testing.T) {
+	w := newChanWriter()
+	c := NewPerfectCodec(w, 240_000)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Start()
+	}()
+	defer func() {
+		c.Close()
+		<-done
+	}()
+
+	if f := receiveFrame(t, w); len(f.Content) != 1000 {
+		t.Errorf("frame has %v bytes at 240 kbps, want 1000", len(f.Content))
+	}
+	c.SetTargetBitrate(480_000)
+	if got := c.GetTargetBitrate(); got != 480_000 {
+		t.Errorf("target bitrate %v, want 480000", got)
+	}
+	// Frames generated before the update may still be buffered.
+	for i := 0; i < 10; i++ {
+		if f := receiveFrame(t, w); len(f.Content) == 2000 {
+			return
+		}
+	}
+	t.Error("no frame of 2000 bytes after doubling the target bitrate")
+}
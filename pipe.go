@@ -0,0 +1,77 @@
+package syncodec
+
+import (
+	"io"
+	"sync"
+)
+
+var (
+	_ FrameWriter = (*FramePipe)(nil)
+	_ FrameReader = (*FramePipe)(nil)
+)
+
+// FramePipe is a buffered in-memory pipe connecting a FrameWriter to a
+// FrameReader, e.g. to feed the output of an encoder into a decoder.
+type FramePipe struct {
+	frames chan Frame
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewFramePipe returns a FramePipe which buffers up to size frames. WriteFrame
+// blocks while the buffer is full.
+func NewFramePipe(size int) *FramePipe {
+	return &FramePipe{
+		frames: make(chan Frame, size),
+		done:   make(chan struct{}),
+	}
+}
+
+// WriteFrame adds f to the pipe. Frames written after Close are dropped and
+// WriteFrame returns io.ErrClosedPipe.
+func (p *FramePipe) WriteFrame(f Frame) error {
+	// Check done first, since select picks randomly between ready cases and
+	// would otherwise still buffer frames after Close.
+	select {
+	case <-p.done:
+		return io.ErrClosedPipe
+	default:
+	}
+	select {
+	case p.frames <- f:
+		return nil
+	case <-p.done:
+		return io.ErrClosedPipe
+	}
+}
+
+// ReadFrame returns the next frame from the pipe. It blocks until a frame is
+// available or the pipe is closed. After Close, buffered frames are still
+// returned before ReadFrame returns io.EOF.
+func (p *FramePipe) ReadFrame() (Frame, error) {
+	select {
+	case f := <-p.frames:
+		return f, nil
+	default:
+	}
+	select {
+	case f := <-p.frames:
+		return f, nil
+	case <-p.done:
+		select {
+		case f := <-p.frames:
+			return f, nil
+		default:
+			return Frame{}, io.EOF
+		}
+	}
+}
+
+// Close closes the pipe. Calling Close more than once has no effect.
+func (p *FramePipe) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.done)
+	})
+	return nil
+}
@@ -0,0 +1,19 @@
+package syncodec
+
+import (
+	"io"
+	"testing"
+)
+
+func TestFramePipeWriteAfterClose(t *testing.T) {
+	pipe := NewFramePipe(16)
+	pipe.Close()
+	for i := 0; i < 100; i++ {
+		if err := pipe.WriteFrame(Frame{SeqNr: uint64(i)}); err != io.ErrClosedPipe {
+			t.Fatalf("write %v after Close returned %v, want %v", i, err, io.ErrClosedPipe)
+		}
+	}
+	if f, err := pipe.ReadFrame(); err != io.EOF {
+		t.Fatalf("ReadFrame returned frame %v and error %v, want %v", f.SeqNr, err, io.EOF)
+	}
+}
@@ -0,0 +1,75 @@
+// Package promcollector exports the output of syncodec codecs as Prometheus
+// metrics.
+package promcollector
+
+import (
+	"time"
+
+	"github.com/mengelbart/syncodec"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	_ syncodec.Collector   = (*Collector)(nil)
+	_ prometheus.Collector = (*Collector)(nil)
+)
+
+// Collector implements syncodec.Collector and exposes a frame size histogram,
+// a frame counter and a gauge of the current target bitrate. Register it with
+// a prometheus.Registerer to export the metrics.
+type Collector struct {
+	frameSize     prometheus.Histogram
+	frames        prometheus.Counter
+	targetBitrate prometheus.Gauge
+}
+
+// NewCollector returns a new Collector whose metrics are prefixed by
+// namespace.
+func NewCollector(namespace string) *Collector {
+	return &Collector{
+		frameSize: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "syncodec",
+			Name:      "frame_size_bytes",
+			Help:      "Size of emitted frames in bytes.",
+			Buckets:   prometheus.ExponentialBuckets(256, 2, 10),
+		}),
+		frames: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "syncodec",
+			Name:      "frames_total",
+			Help:      "Number of emitted frames.",
+		}),
+		targetBitrate: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "syncodec",
+			Name:      "target_bitrate_bps",
+			Help:      "Current target bitrate in bits per second.",
+		}),
+	}
+}
+
+// ObserveFrame implements syncodec.Collector.
+func (c *Collector) ObserveFrame(size int, _ time.Duration) {
+	c.frameSize.Observe(float64(size))
+	c.frames.Inc()
+}
+
+// ObserveBitrateUpdate implements syncodec.Collector.
+func (c *Collector) ObserveBitrateUpdate(bps int) {
+	c.targetBitrate.Set(float64(bps))
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.frameSize.Describe(ch)
+	c.frames.Describe(ch)
+	c.targetBitrate.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.frameSize.Collect(ch)
+	c.frames.Collect(ch)
+	c.targetBitrate.Collect(ch)
+}
@@ -0,0 +1,47 @@
+package promcollector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollectorMetrics(t *testing.T) {
+	c := NewCollector("test")
+	c.ObserveBitrateUpdate(500_000)
+	c.ObserveBitrateUpdate(1_000_000)
+	for _, size := range []int{200, 1000, 5000} {
+		c.ObserveFrame(size, 0)
+	}
+
+	expected := `
+# HELP test_syncodec_frame_size_bytes Size of emitted frames in bytes.
+# TYPE test_syncodec_frame_size_bytes histogram
+test_syncodec_frame_size_bytes_bucket{le="256"} 1
+test_syncodec_frame_size_bytes_bucket{le="512"} 1
+test_syncodec_frame_size_bytes_bucket{le="1024"} 2
+test_syncodec_frame_size_bytes_bucket{le="2048"} 2
+test_syncodec_frame_size_bytes_bucket{le="4096"} 2
+test_syncodec_frame_size_bytes_bucket{le="8192"} 3
+test_syncodec_frame_size_bytes_bucket{le="16384"} 3
+test_syncodec_frame_size_bytes_bucket{le="32768"} 3
+test_syncodec_frame_size_bytes_bucket{le="65536"} 3
+test_syncodec_frame_size_bytes_bucket{le="131072"} 3
+test_syncodec_frame_size_bytes_bucket{le="+Inf"} 3
+test_syncodec_frame_size_bytes_sum 6200
+test_syncodec_frame_size_bytes_count 3
+# HELP test_syncodec_frames_total Number of emitted frames.
+# TYPE test_syncodec_frames_total counter
+test_syncodec_frames_total 3
+# HELP test_syncodec_target_bitrate_bps Current target bitrate in bits per second.
+# TYPE test_syncodec_target_bitrate_bps gauge
+test_syncodec_target_bitrate_bps 1e+06
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(c); n != 3 {
+		t.Errorf("collected %v metrics, want 3", n)
+	}
+}
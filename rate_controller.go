@@ -0,0 +1,17 @@
+package syncodec
+
+// RateController implements a rate adaptation policy driven by the output of
+// a codec. The codec consults it after writing each media frame.
+type RateController interface {
+	// OnFrame is called with every media frame written by the codec. If
+	// changed is true, the codec requests newTarget as its target bitrate,
+	// which is handled like a request by RequestTargetBitrate, i.e. subject
+	// to the reaction latency and starting a transient burst.
+	OnFrame(f Frame) (newTarget int, changed bool)
+}
+
+type nopRateController struct{}
+
+func (nopRateController) OnFrame(Frame) (int, bool) {
+	return 0, false
+}
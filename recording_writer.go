@@ -0,0 +1,40 @@
+package syncodec
+
+import "sync"
+
+var _ FrameWriter = (*RecordingFrameWriter)(nil)
+
+// RecordingFrameWriter is a FrameWriter which records all written frames for
+// later inspection, e.g. in tests. The zero value is ready to use and it is
+// safe for concurrent use.
+type RecordingFrameWriter struct {
+	lock   sync.Mutex
+	frames []Frame
+}
+
+// WriteFrame records f. It never returns an error.
+func (w *RecordingFrameWriter) WriteFrame(f Frame) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.frames = append(w.frames, f)
+	return nil
+}
+
+// Frames returns a copy of the recorded frames in the order they were written.
+func (w *RecordingFrameWriter) Frames() []Frame {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	frames := make([]Frame, len(w.frames))
+	copy(frames, w.frames)
+	return frames
+}
+
+// Reset discards all recorded frames.
+func (w *RecordingFrameWriter) Reset() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.frames = nil
+}
@@ -0,0 +1,39 @@
+package syncodec
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestRecordingFrameWriter(t *testing.T) {
+	w := &RecordingFrameWriter{}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				w.WriteFrame(Frame{})
+			}
+		}()
+	}
+	wg.Wait()
+	if n := len(w.Frames()); n != 100 {
+		t.Errorf("recorded %v frames, want 100", n)
+	}
+
+	w.Reset()
+	if n := len(w.Frames()); n != 0 {
+		t.Errorf("%v frames recorded after Reset", n)
+	}
+	w.WriteFrame(Frame{SeqNr: 1})
+	w.WriteFrame(Frame{SeqNr: 2})
+	frames := w.Frames()
+	if len(frames) != 2 || frames[0].SeqNr != 1 || frames[1].SeqNr != 2 {
+		t.Errorf("recorded %v, want frames 1 and 2 in order", frames)
+	}
+	frames[0].SeqNr = 42
+	if w.Frames()[0].SeqNr != 1 {
+		t.Error("Frames returned the recorded slice instead of a copy")
+	}
+}
@@ -0,0 +1,175 @@
+package syncodec
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+)
+
+var _ Codec = (*SimulcastCodec)(nil)
+
+// SimulcastCodec models a simulcast encoder which encodes the same source in
+// multiple independent quality layers. Each layer is a StatisticalCodec whose
+// target bitrate is a fixed share of the total target bitrate. All layers
+// encode the same pictures: The first layer runs the frame schedule, and
+// whenever it generates a frame, every other layer generates a frame with the
+// same PTS and duration. Frames of all layers are written to a single
+// FrameWriter and tagged with the LayerID of the layer which generated them.
+type SimulcastCodec struct {
+	layers []*StatisticalCodec
+
+	// share of the total target bitrate of each layer
+	shares []float64
+
+	// bounds of the total target bitrate
+	rMin int
+	rMax int
+
+	lock             sync.Mutex
+	targetBitrateBps int
+}
+
+// NewSimulcastCodec creates a SimulcastCodec with one layer per entry of
+// ratios and an initial total target bitrate of targetBitrateBps, which must
+// lie within the rate bounds. The target bitrate of layer i is
+// targetBitrateBps * ratios[i] / sum(ratios), e.g. ratios of 1, 2 and 4 result
+// in layers with a quarter, half and full bitrate of the highest layer. All
+// layers are configured with opts, except that the rate bounds set by
+// WithRateBounds apply to the total target bitrate and each layer gets the
+// share of the bounds matching its ratio, and that each layer gets its own
+// seed derived from the seed set by WithRandSeed. Options which would make
+// the layers share a sink, a noise seed or a noiser, i.e. WithWriter,
+// WithFrameChannel, WithSizeNoiseSeed, WithDurationNoiseSeed,
+// WithFrameSizeNoiser, WithFrameDurationNoiser and WithInterFrameModel, are
+// rejected.
+func NewSimulcastCodec(w FrameWriter, targetBitrateBps int, ratios []float64, opts ...StatisticalCodecOption) (*SimulcastCodec, error) {
+	if len(ratios) == 0 {
+		return nil, errors.New("simulcast codec requires at least one layer")
+	}
+	sum := 0.0
+	for _, r := range ratios {
+		if r <= 0 {
+			return nil, errors.New("layer ratios must be positive")
+		}
+		sum += r
+	}
+	if w == nil {
+		return nil, errors.New("writer must not be nil")
+	}
+
+	// The probe validates opts and resolves the seed and rate bounds they
+	// configure.
+	probeWriter := &simulcastLayerWriter{}
+	probe, err := NewStatisticalEncoder(probeWriter, append(opts, WithInitialTargetBitrate(targetBitrateBps), WithMetricsCollector(nopCollector{}), rejectSharedNoisers)...)
+	if err != nil {
+		return nil, err
+	}
+	probe.Close()
+	if probe.writer != FrameWriter(probeWriter) || probe.frames != nil {
+		return nil, errors.New("simulcast layers must not have their own writer or frame channel")
+	}
+	if probe.sizeNoiseSeed != nil || probe.durationNoiseSeed != nil {
+		return nil, errors.New("simulcast layers must not share a noise seed")
+	}
+
+	sc := &SimulcastCodec{
+		layers:           make([]*StatisticalCodec, len(ratios)),
+		shares:           make([]float64, len(ratios)),
+		rMin:             probe.rMin,
+		rMax:             probe.rMax,
+		lock:             sync.Mutex{},
+		targetBitrateBps: 0,
+	}
+	seeds := rand.New(rand.NewSource(probe.seed))
+	writerLock := &sync.Mutex{}
+	for i, r := range ratios {
+		share := r / sum
+		rMin := max(int(float64(sc.rMin)*share), 1)
+		rMax := max(int(float64(sc.rMax)*share), rMin)
+		layerOpts := append(opts[:len(opts):len(opts)],
+			WithRandSeed(seeds.Int63()),
+			WithRateBounds(rMin, rMax),
+			WithInitialTargetBitrate(min(max(int(float64(targetBitrateBps)*share), rMin), rMax)),
+		)
+		layer, err := NewStatisticalEncoder(&simulcastLayerWriter{
+			lock:    writerLock,
+			writer:  w,
+			layerID: i,
+		}, layerOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("layer %v: %w", i, err)
+		}
+		sc.layers[i] = layer
+		sc.shares[i] = share
+	}
+	sc.layers[0].followers = sc.layers[1:]
+	sc.SetTargetBitrate(targetBitrateBps)
+	return sc, nil
+}
+
+// GetTargetBitrate returns the total target bitrate of all layers in bit per
+// second.
+func (c *SimulcastCodec) GetTargetBitrate() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.targetBitrateBps
+}
+
+// SetTargetBitrate sets the total target bitrate to r bits per second, clamped
+// to the rate bounds, and redistributes it among the layers according to their
+// ratios.
+func (c *SimulcastCodec) SetTargetBitrate(r int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	r = min(max(r, c.rMin), c.rMax)
+	c.targetBitrateBps = r
+	for i, layer := range c.layers {
+		layer.SetTargetBitrate(int(float64(r) * c.shares[i]))
+	}
+}
+
+// Start runs all layers and blocks until Close is called or the first layer
+// reaches a limit set by WithMaxFrames or WithMaxDuration, which closes all
+// layers.
+func (c *SimulcastCodec) Start() {
+	c.layers[0].Start()
+	c.Close()
+}
+
+// Close stops all layers. Calling Close more than once has no effect.
+func (c *SimulcastCodec) Close() error {
+	for _, layer := range c.layers {
+		if err := layer.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rejectSharedNoisers is applied after the options of a SimulcastCodec, before
+// the default noisers are created, to reject noisers all layers would share.
+func rejectSharedNoisers(sc *StatisticalCodec) error {
+	if sc.frameSizeNoiser != nil || sc.frameDurationNoiser != nil || sc.interFrameModel != nil {
+		return errors.New("simulcast layers must not share a noiser or inter frame model")
+	}
+	return nil
+}
+
+// simulcastLayerWriter tags frames with the id of a layer and serializes
+// writes of all layers to the shared FrameWriter.
+type simulcastLayerWriter struct {
+	lock    *sync.Mutex
+	writer  FrameWriter
+	layerID int
+}
+
+func (w *simulcastLayerWriter) WriteFrame(f Frame) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	f.LayerID = w.layerID
+	return w.writer.WriteFrame(f)
+}
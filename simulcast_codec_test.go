@@ -0,0 +1,117 @@
+package syncodec
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestSimulcastCodecLayersTrackTotalTarget(t *testing.T) {
+	c, err := NewSimulcastCodec(newChanWriter(), 3_000_000, []float64{1, 2, 4}, WithRateBounds(300_000, 6_000_000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, total := range []int{3_000_000, 300_000, 6_000_000, 10_000_000} {
+		c.SetTargetBitrate(total)
+		want := min(total, 6_000_000)
+		if got := c.GetTargetBitrate(); got != want {
+			t.Errorf("total target %v, want %v", got, want)
+		}
+		sum := 0
+		for _, layer := range c.layers {
+			sum += layer.GetTargetBitrate()
+		}
+		// Each layer rounds its share down by less than one bit per second.
+		if sum > want || sum < want-len(c.layers) {
+			t.Errorf("layers sum up to %v bps for total target %v", sum, want)
+		}
+	}
+}
+
+func TestSimulcastCodecLayersUseDistinctSeeds(t *testing.T) {
+	c, err := NewSimulcastCodec(newChanWriter(), 1_000_000, []float64{1, 1}, WithRandSeed(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	identical := true
+	for i := 0; i < 10; i++ {
+		a, _ := c.layers[0].nextFrame()
+		b, _ := c.layers[1].nextFrame()
+		if len(a.Content) != len(b.Content) {
+			identical = false
+		}
+	}
+	if identical {
+		t.Error("layers with equal ratios generated identical frame sizes")
+	}
+}
+
+func TestSimulcastCodecRejectsPerLayerOptions(t *testing.T) {
+	model, err := NewExponentialInterFrameModel(30, rand.NewSource(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, opt := range map[string]StatisticalCodecOption{
+		"writer":              WithWriter(newChanWriter()),
+		"frame channel":       WithFrameChannel(1),
+		"size noise seed":     WithSizeNoiseSeed(1),
+		"duration noise seed": WithDurationNoiseSeed(1),
+		"size noiser":         WithFrameSizeNoiser(NewLaplaceNoiser(0.1, rand.NewSource(1))),
+		"duration noiser":     WithFrameDurationNoiser(NewLaplaceNoiser(0.1, rand.NewSource(1))),
+		"inter frame model":   WithInterFrameModel(model),
+	} {
+		if _, err := NewSimulcastCodec(newChanWriter(), 1_000_000, []float64{1, 2}, opt); err == nil {
+			t.Errorf("%v option accepted", name)
+		}
+	}
+}
+
+func TestSimulcastCodecLayersShareFrameSchedule(t *testing.T) {
+	ratios := []float64{1, 2, 4}
+	const total = 1_400_000
+	clock := newFakeClock()
+	w := newChanWriter()
+	c, err := NewSimulcastCodec(w, total, ratios, WithClock(clock), WithRandSeed(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Start()
+	}()
+	t.Cleanup(func() {
+		c.Close()
+		<-done
+	})
+	clock.BlockUntil(1)
+
+	const pictures = 600
+	frames := nextFrames(t, clock, w, pictures*len(ratios))
+	bytes := make([]int, len(ratios))
+	duration := time.Duration(0)
+	for i := 0; i < pictures; i++ {
+		picture := frames[i*len(ratios) : (i+1)*len(ratios)]
+		for id, f := range picture {
+			if f.LayerID != id {
+				t.Fatalf("picture %v: frame %v has layer %v", i, id, f.LayerID)
+			}
+			if f.PTS != picture[0].PTS || f.Duration != picture[0].Duration {
+				t.Fatalf("picture %v: layer %v has PTS %v and duration %v, want %v and %v", i, id, f.PTS, f.Duration, picture[0].PTS, picture[0].Duration)
+			}
+			bytes[id] += len(f.Content)
+		}
+		if picture[0].PTS != duration {
+			t.Fatalf("picture %v has PTS %v, want %v", i, picture[0].PTS, duration)
+		}
+		duration += picture[0].Duration
+	}
+	for id, r := range ratios {
+		got := float64(8*bytes[id]) / duration.Seconds()
+		want := total * r / 7
+		if math.Abs(got-want) > 0.05*want {
+			t.Errorf("layer %v emitted %.0f bps, want %.0f", id, got, want)
+		}
+	}
+}
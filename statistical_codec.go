@@ -1,16 +1,21 @@
 package syncodec
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
 	"math"
+	"math/bits"
 	"math/rand"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-func init() {
-	rand.Seed(time.Now().UnixNano())
-}
-
+// Default model parameters as suggested in section 5 of RFC 8593. Bitrates
+// are in bits per second, frame sizes in bytes.
 const (
 	defaultTargetBitrateBps = 1_000_000 // 1 Mbps
 	defaultFPS              = 30
@@ -18,7 +23,7 @@ const (
 	defaultBurstFrameCount  = 8
 	defaultBurstFrameSize   = 13_500 // 13.5 KB
 	defaultT0               = 33 * time.Millisecond
-	defaultB0               = 4_170 // 4.17 KB
+	defaultB0               = 4_170 // 4.17 KB, 1 Mbps at 30 FPS
 
 	// scaling parameter of zero-mean laplacian distribution describing
 	// deviations in normalized frame interval
@@ -28,32 +33,208 @@ const (
 	// deviations in normalized frame size
 	defaultScaleB = 0.15
 
-	defaultRMin = 150_000     // 150 kbps
-	defaultRMax = 150_000_000 // 150 Mbps
+	defaultRMin = 150_000   // 150 kbps
+	defaultRMax = 1_500_000 // 1.5 Mbps
+)
+
+const (
+	// size of key frames relative to the average frame size
+	defaultKeyFrameSizeFactor = 4.0
+
+	// maximum number of SVC temporal layers
+	maxTemporalLayers = 8
+
+	// maximum supported frame rate
+	maxFPS = 1000
+
+	// quantizer at which frames have the reference frame size b0, and the
+	// maximum quantizer of the VP8 range
+	referenceQP = 32
+	maxQP       = 127
+
+	// default exponent of the quantizer size model
+	defaultQuantizerExponent = 1.0
+
+	// default soft floor of steady state frame sizes in bytes
+	defaultFrameSizeFloor = 1
+
+	// length of the window of the windowed statistics
+	defaultStatsWindow = time.Second
+)
+
+// ContentFill describes the pattern used to fill the content of generated
+// frames.
+type ContentFill int
+
+const (
+	// ContentFillZero leaves the content of frames zeroed.
+	ContentFillZero ContentFill = iota
+
+	// ContentFillRandom fills frames with random bytes, which do not compress.
+	ContentFillRandom
+
+	// ContentFillIncrementing fills frames with the byte sequence 0, 1, ...,
+	// 255, 0, 1, ...
+	ContentFillIncrementing
 )
 
-type noiser interface {
-	noise() float64
+// BoundsError reports that the model of a StatisticalCodec generated an out
+// of range value, which the codec clamped to the nearest valid value.
+type BoundsError struct {
+	// SeqNr is the sequence number of the affected frame.
+	SeqNr uint64
+
+	// Quantity names the clamped value, e.g. "frame size".
+	Quantity string
+
+	// Value is the value generated by the model.
+	Value float64
+
+	// Bound is the value the codec used instead.
+	Bound float64
 }
 
-type laplaceNoise struct {
-	rnd   *rand.Rand
-	scale float64
+func (e *BoundsError) Error() string {
+	return fmt.Sprintf("frame %v: %v %v out of bounds, clamped to %v", e.SeqNr, e.Quantity, e.Value, e.Bound)
+}
+
+// CodecStats is a snapshot of the statistics of a StatisticalCodec.
+type CodecStats struct {
+	// FramesEmitted is the number of frames written so far.
+	FramesEmitted uint64
+
+	// BytesEmitted is the total size of all frames written so far.
+	BytesEmitted uint64
+
+	// TargetBitrate is the current target bitrate in bits per second.
+	TargetBitrate int
+
+	// SinceLastBitrateUpdate is the time elapsed since the target bitrate was
+	// last set, either at construction or by a rate update.
+	SinceLastBitrateUpdate time.Duration
+
+	// RemainingBurstFrames is the number of frames left in the current
+	// transient burst.
+	RemainingBurstFrames int
+
+	// Window is the length of the statistics window set by WithStatsWindow.
+	Window time.Duration
+
+	// WindowFrames and WindowBytes are the number and total size of the
+	// frames written within the statistics window preceding the snapshot.
+	WindowFrames uint64
+	WindowBytes  uint64
+
+	// WriteTimeouts is the number of frames dropped because the writer did
+	// not accept them within the timeout set by WithWriteTimeout.
+	WriteTimeouts uint64
+
+	// WriteErrors is the number of frames the writer returned an error for,
+	// and LastWriteError the most recent of these errors.
+	WriteErrors    uint64
+	LastWriteError error
 }
 
-func (l laplaceNoise) noise() float64 {
-	if l.rnd == nil {
-		l.rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+// ErrorPolicy determines how a StatisticalCodec handles errors returned by its
+// FrameWriter. Write errors are counted in CodecStats under all policies.
+type ErrorPolicy int
+
+const (
+	// ErrorPolicyCount only counts write errors and continues. This is the
+	// default.
+	ErrorPolicyCount ErrorPolicy = iota
+
+	// ErrorPolicyLog logs write errors using the standard logger and
+	// continues.
+	ErrorPolicyLog
+
+	// ErrorPolicyStop stops the codec at the first write error as if Close
+	// was called.
+	ErrorPolicyStop
+)
+
+// WindowBitrate returns the output bitrate in bits per second within the
+// statistics window.
+func (s CodecStats) WindowBitrate() int {
+	if s.Window <= 0 {
+		return 0
 	}
-	e1 := -l.scale * math.Log(l.rnd.Float64())
-	e2 := -l.scale * math.Log(l.rnd.Float64())
-	return e1 - e2
+	return int(float64(s.WindowBytes*8) / s.Window.Seconds())
+}
+
+// windowRecord is a frame written within the statistics window.
+type windowRecord struct {
+	at   time.Time
+	size int
+}
+
+// TransientShape describes how the overshoot of the transient burst following
+// a rate update is distributed over the burst frames.
+type TransientShape int
+
+const (
+	// TransientSquare spends the whole overshoot on the first burst frame,
+	// as described in RFC 8593. This is the default.
+	TransientSquare TransientShape = iota
+
+	// TransientLinear spends a linearly decreasing share of the overshoot on
+	// each burst frame.
+	TransientLinear
+
+	// TransientExponential halves the share of the overshoot spent on each
+	// burst frame compared to the previous one.
+	TransientExponential
+)
+
+// Phase describes how the frame sizes of a StatisticalCodec currently relate
+// to its target bitrate.
+type Phase int
+
+const (
+	// PhaseSteady means frame sizes follow the target bitrate.
+	PhaseSteady Phase = iota
+
+	// PhaseBurst means the codec is in the transient burst after a rate
+	// update.
+	PhaseBurst
+
+	// PhaseRamp means the effective bitrate approaches the target bitrate
+	// gradually as configured by WithRateRamp.
+	PhaseRamp
+)
+
+// codecState is the lifecycle state of a StatisticalCodec.
+type codecState int
+
+const (
+	// The codec is not running and can be started, either because it was
+	// never started or because its run loop returned after its context was
+	// cancelled.
+	stateCreated codecState = iota
+
+	// The run loop of the codec is running.
+	stateRunning
+
+	// The codec was closed and cannot be started anymore.
+	stateClosed
+)
+
+// BitrateEvent is a target bitrate update scheduled by ScheduleBitrate.
+type BitrateEvent struct {
+	// Offset is the time after Start at which the update is applied.
+	Offset time.Duration
+
+	// TargetBitrate is the new target bitrate in bits per second.
+	TargetBitrate int
 }
 
+// errorChannelSize is the number of errors buffered in strict mode.
+const errorChannelSize = 16
+
 var _ Codec = (*StatisticalCodec)(nil)
 
 type StatisticalCodec struct {
-	// requested target bitrate
+	// requested target bitrate in bits per second
 	targetBitrateBps int
 
 	// Frames per second
@@ -65,24 +246,36 @@ type StatisticalCodec struct {
 	// burst duration of transient period in frames
 	burstFrameCount int
 
-	// burst frame size during transient period
+	// burst frame size in bytes during transient period
 	burstFrameSize int
 
 	// reference time interval 1/FPS
 	t0 time.Duration
 
-	// reference frame size targetBitrateBps / fps
+	// reference frame size in bytes targetBitrateBps / (8 * fps)
 	b0 int
 
-	// max rate supported by video encoder
+	// exponent k of the quantizer size model b0 * (referenceQP / qp)^k
+	quantizerExponent float64
+
+	// min rate in bits per second supported by video encoder
 	rMin int
 
-	// min rate supported by video encoder
+	// max rate in bits per second supported by video encoder
 	rMax int
 
 	// output writer
 	writer FrameWriter
 
+	// collector observing the generated frames and bitrate updates
+	collector Collector
+
+	// rate adaptation policy consulted after every media frame
+	rateController RateController
+
+	// hooks called with every frame before it is written
+	frameHooks []func(*Frame)
+
 	// scaling parameter of zero-mean laplacian distribution describing
 	// deviations in normalized frame size
 	scaleB float64
@@ -91,184 +284,2240 @@ type StatisticalCodec struct {
 	// deviations in normalized frame interval
 	scaleT float64
 
+	// sign conventions applied to frame size and frame duration noise
+	sizeNoiseSign     NoiseSign
+	durationNoiseSign NoiseSign
+
+	// seed of the random number generators used by the noisers
+	seed int64
+
+	// seeds of the frame size and frame duration noisers overriding the
+	// streams derived from seed, nil if derived from seed
+	sizeNoiseSeed     *int64
+	durationNoiseSeed *int64
+
+	// distribution of the overshoot over the frames of the transient burst
+	transientShape TransientShape
+
+	// minimum time between the end of a transient burst and the start of
+	// the next one, 0 allows a new burst to interrupt an ongoing one
+	minBurstInterval time.Duration
+
+	// number of frames over which the frame size settles to steady state
+	// after the transient burst, 0 disables settling
+	burstDecayFrames int
+
+	// whether frames of the transient burst are noised
+	noiseDuringBurst bool
+
+	// number of frames in a group of pictures, 0 disables key frames
+	gopSize int
+
+	// size of key frames relative to the average frame size
+	keyFrameSizeFactor float64
+
+	// factor by which the target bitrate must change to trigger a key frame,
+	// 0 disables key frames on rate changes
+	keyFrameRateChangeFactor float64
+
+	// number of SVC temporal layers
+	temporalLayers int
+
+	// shares of the SVC spatial layers in the bitrate, nil if spatial layers
+	// are disabled
+	spatialLayerShares []float64
+
+	// pattern used to fill the content of frames
+	contentFill ContentFill
+
+	// pool of frame content buffers, nil if pooling is disabled
+	bufferPool *sync.Pool
+
+	// smallest frame in bytes the encoder emits, smaller frames are dropped
+	minFrameSize int
+
+	// largest frame in bytes the encoder emits, 0 means unlimited
+	maxFrameSize int
+
+	// smallest size in bytes of steady state frames, whose deficit is
+	// borrowed from the following frames
+	frameSizeFloor int
+
+	// noise applied to the interval between writing two frames, nil if the
+	// interval is the duration of the frame
+	scheduleJitter Noiser
+
+	// whether frames are written on a fixed grid of 1/fps intervals
+	// independent of their duration
+	fixedSchedule bool
+
+	// source of time of the run loop and rate control
+	clock Clock
+
+	// model of the intervals between frames, nil if frames are generated at
+	// a constant rate of fps
+	interFrameModel InterFrameModel
+
+	// number of media frames and duration after which the run loop stops,
+	// 0 means unlimited
+	maxFrames   int
+	maxDuration time.Duration
+
+	// called when the run loop stops because a limit was reached
+	onFinish func()
+
+	// number of media frames protected by one FEC frame, 0 disables FEC
+	fecGroupSize int
+
+	// size of FEC frames relative to the size of the protected frames
+	fecOverhead float64
+
+	// channel on which clamped values are reported in strict mode, nil if
+	// strict mode is disabled
+	errs chan error
+
+	// channel to which frames are sent in addition to the writer, nil if
+	// disabled
+	frames chan Frame
+
+	// length of the window of the windowed statistics
+	statsWindow time.Duration
+
+	// time after which a blocking write is abandoned, 0 waits indefinitely
+	writeTimeout time.Duration
+
+	// handling of errors returned by the writer
+	errorPolicy ErrorPolicy
+
+	// bitrate change in bits per second per rampInterval while the effective
+	// bitrate ramps towards the target bitrate, 0 disables ramping
+	rampStep     int
+	rampInterval time.Duration
+
+	// weight of a new target bitrate in the exponentially weighted moving
+	// average of target bitrates, 0 disables smoothing
+	bitrateSmoothing float64
+
 	// internal types
 
-	targetBitrateLock       sync.Mutex
+	// per instance random number generator seeded from seed, from which the
+	// noisers derive their own sources
+	rnd *rand.Rand
+
+	// lock guards targetBitrateBps, requestedBitrateBps, effectiveBitrateBps,
+	// fps, quantizer, keyFrameRequested, paused, state, stopped, flushOnClose,
+	// framesClosed, schedule, window, nextFrameAt and the statistics, which
+	// may be accessed concurrently with the run loop
+	lock                    sync.Mutex
+	schedule                []BitrateEvent
+	quantizer               int
+	keyFrameRequested       bool
+	paused                  bool
+	state                   codecState
+	stopped                 chan struct{}
+	flushOnClose            bool
+	framesClosed            bool
+	requestedBitrateBps     int
+	effectiveBitrateBps     int
+	lastRampUpdate          time.Time
+	stats                   CodecStats
+	window                  []windowRecord
+	lastBitrateChange       time.Time
+	nextFrameAt             time.Time
 	targetBitrateChan       chan int
 	lastTargetBitrateUpdate time.Time
 
 	remainingBurstFrames int
 
-	frameSizeNoiser     noiser
-	frameDurationNoiser noiser
+	// time at which the latest transient burst ended
+	lastBurstEnd time.Time
+
+	// number of steady state frames left in the settling period after the
+	// current transient burst
+	remainingDecayFrames int
+
+	// whether a periodic key frame fell due during the current transient
+	// burst and is emitted after it
+	keyFrameDeferred bool
+
+	// bytes of dropped or capped frames which are added to the next frame
+	carryBytes int
+
+	// number and total size of media frames in the current FEC group
+	fecGroupFrames int
+	fecGroupBytes  int64
+
+	// frames written by the write worker if a write timeout is set, and the
+	// results of the writes. The queue is closed with the codec.
+	writeQueue   chan Frame
+	writeResults chan error
+
+	// whether the write worker is busy with an abandoned write
+	writePending bool
+
+	// frame of the abandoned write
+	pendingFrame Frame
 
-	done chan struct{}
+	// whether the run loop writes the remaining burst frames on close
+	flushing bool
+
+	// number of media frames generated since Start
+	frameCount uint64
+
+	// sequence number of the next frame
+	seqNr uint64
+
+	// presentation timestamp of the next frame
+	pts time.Duration
+
+	// codecs which generate a frame whenever the run loop of this codec
+	// generates one, e.g. the higher layers of a SimulcastCodec
+	followers []*StatisticalCodec
+
+	frameSizeNoiser     Noiser
+	frameDurationNoiser Noiser
+
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 type StatisticalCodecOption func(*StatisticalCodec) error
 
+// WithInitialTargetBitrate sets the target bitrate in bits per second the
+// codec starts with. The bitrate must be within the range supported by the
+// encoder, otherwise NewStatisticalEncoder returns an error.
 func WithInitialTargetBitrate(targetBitrateBps int) StatisticalCodecOption {
 	return func(sc *StatisticalCodec) error {
+		if targetBitrateBps <= 0 {
+			return errors.New("initial target bitrate must be positive")
+		}
 		sc.targetBitrateBps = targetBitrateBps
 		return nil
 	}
 }
 
+// WithFramesPerSecond sets the frame rate of the codec. The frame rate must be
+// in [1, 1000].
 func WithFramesPerSecond(fps int) StatisticalCodecOption {
 	return func(sc *StatisticalCodec) error {
+		if err := validateFPS(fps); err != nil {
+			return err
+		}
 		sc.fps = fps
 		return nil
 	}
 }
 
-func WithScaleB(scale float64) StatisticalCodecOption {
+// seedCounter is mixed into default seeds so that codecs constructed within
+// the same clock tick still get distinct seeds.
+var seedCounter uint64
+
+func defaultSeed() int64 {
+	n := atomic.AddUint64(&seedCounter, 1)
+	return int64(uint64(time.Now().UnixNano()) ^ n*0x9E3779B97F4A7C15)
+}
+
+func validateFPS(fps int) error {
+	if fps <= 0 || fps > maxFPS {
+		return fmt.Errorf("fps %v out of range [1, %v]", fps, maxFPS)
+	}
+	return nil
+}
+
+// WithReactionLatency sets the encoder reaction latency tau. Target bitrate
+// updates arriving within tau of the previous update, or within tau after
+// Start, are ignored. A tau of 0 disables rate limiting, such that every
+// update is accepted.
+func WithReactionLatency(tau time.Duration) StatisticalCodecOption {
 	return func(sc *StatisticalCodec) error {
-		sc.scaleB = scale
+		if tau < 0 {
+			return errors.New("reaction latency must not be negative")
+		}
+		sc.tau = tau
 		return nil
 	}
 }
 
-func WithScaleT(scale float64) StatisticalCodecOption {
+// WithBurstFrameCount sets the number of frames of the transient period
+// following a target bitrate update.
+func WithBurstFrameCount(n int) StatisticalCodecOption {
 	return func(sc *StatisticalCodec) error {
-		sc.scaleT = scale
+		if n <= 0 {
+			return errors.New("burst frame count must be positive")
+		}
+		sc.burstFrameCount = n
 		return nil
 	}
 }
 
-func min(a, b int) int {
-	if a < b {
-		return a
+// WithoutBurst disables the transient burst, such that target bitrate updates
+// switch to steady state frames of the new bitrate at once.
+func WithoutBurst() StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		sc.burstFrameCount = 0
+		return nil
 	}
-	return b
 }
 
-func max(a, b int) int {
-	if a > b {
-		return a
+// WithBurstFrameSize sets the size in bytes of the first frame of the
+// transient period following a target bitrate update.
+func WithBurstFrameSize(bytes int) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if bytes <= 0 {
+			return errors.New("burst frame size must be positive")
+		}
+		sc.burstFrameSize = bytes
+		return nil
 	}
-	return b
 }
 
-func NewStatisticalEncoder(w FrameWriter, opts ...StatisticalCodecOption) (*StatisticalCodec, error) {
-	sc := &StatisticalCodec{
-		targetBitrateBps:        defaultTargetBitrateBps,
-		fps:                     defaultFPS,
-		tau:                     defaultTau,
-		burstFrameCount:         defaultBurstFrameCount,
-		burstFrameSize:          defaultBurstFrameSize,
-		t0:                      defaultT0,
-		b0:                      defaultB0,
-		rMin:                    defaultRMin,
-		rMax:                    defaultRMax,
-		writer:                  w,
-		scaleB:                  defaultScaleB,
-		scaleT:                  defaultScaleT,
-		targetBitrateLock:       sync.Mutex{},
-		targetBitrateChan:       make(chan int),
-		lastTargetBitrateUpdate: time.Time{},
-		remainingBurstFrames:    0,
-		frameSizeNoiser:         nil,
-		frameDurationNoiser:     nil,
-		done:                    make(chan struct{}),
+// WithTransientShape sets how the overshoot of the transient burst is
+// distributed over the burst frames. All shapes spend the same total
+// overshoot, i.e. burstFrameSize minus the steady state frame size, and the
+// same budget of burstFrameCount steady state frames. The default is
+// TransientSquare.
+func WithTransientShape(shape TransientShape) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if shape < TransientSquare || shape > TransientExponential {
+			return fmt.Errorf("invalid transient shape %v", shape)
+		}
+		sc.transientShape = shape
+		return nil
 	}
+}
 
-	for _, opt := range opts {
-		if err := opt(sc); err != nil {
-			return nil, err
+// WithMinBurstInterval prevents transient bursts from following each other too
+// closely, e.g. to model constraints of the encoder buffer. A rate update only
+// starts a new burst if no burst is in progress and the previous burst ended
+// at least d ago. Other rate updates change the bitrate of steady state frames
+// without a burst.
+func WithMinBurstInterval(d time.Duration) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if d <= 0 {
+			return errors.New("min burst interval must be positive")
 		}
+		sc.minBurstInterval = d
+		return nil
 	}
+}
 
-	sc.frameSizeNoiser = laplaceNoise{
-		rnd:   rand.New(rand.NewSource(time.Now().UnixNano())),
-		scale: sc.scaleB,
+// WithBurstDecay makes the encoder settle to steady state over n frames after
+// the transient burst instead of switching to it at once. The size of the
+// settling frames interpolates linearly from burstFrameSize down to the
+// steady state frame size, i.e. the i-th of the n frames is larger than a
+// steady state frame by (n+1-i)/(n+1) of the difference. The extra bytes are
+// spent in addition to the budget of the burst.
+func WithBurstDecay(n int) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if n <= 0 {
+			return errors.New("burst decay frame count must be positive")
+		}
+		sc.burstDecayFrames = n
+		return nil
 	}
-	sc.frameDurationNoiser = laplaceNoise{
-		rnd:   rand.New(rand.NewSource(time.Now().UnixNano())),
-		scale: sc.scaleT,
+}
+
+// WithNoiseDuringBurst sets whether the frame size and frame duration noise is
+// applied to the frames of the transient burst. By default, burst frames have
+// exactly the sizes of the burst model and the nominal duration, and the noise
+// sources are not advanced during the burst. In both cases, the frames
+// following the burst are regular steady state frames, which are noised from
+// the first frame on.
+func WithNoiseDuringBurst(enabled bool) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		sc.noiseDuringBurst = enabled
+		return nil
 	}
-	sc.SetTargetBitrate(sc.targetBitrateBps)
+}
 
-	return sc, nil
+// WithRateBounds sets the minimum and maximum bitrate in bits per second
+// supported by the encoder. Target bitrates outside of this range are clamped.
+func WithRateBounds(min, max int) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if min <= 0 || max <= 0 {
+			return errors.New("rate bounds must be positive")
+		}
+		if min > max {
+			return fmt.Errorf("min rate %v bps greater than max rate %v bps", min, max)
+		}
+		sc.rMin = min
+		sc.rMax = max
+		return nil
+	}
 }
 
-// GetTargetBitrate returns the current target bitrate in bit per second.
-func (c *StatisticalCodec) GetTargetBitrate() int {
-	c.targetBitrateLock.Lock()
-	defer c.targetBitrateLock.Unlock()
+// WithRandSeed sets the seed used to generate frame size and frame interval
+// noise. Codecs constructed with the same seed and options generate identical
+// sequences of frame sizes and durations. Without WithRandSeed, each codec
+// derives a distinct seed from the current time.
+func WithRandSeed(seed int64) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		sc.seed = seed
+		return nil
+	}
+}
 
-	return c.targetBitrateBps
+// WithSizeNoiseSeed seeds the default frame size noiser with seed instead of a
+// value derived from the seed set by WithRandSeed. Frame size and frame
+// duration noise always use independent random streams, this option only
+// makes the frame size noise reproducible on its own, e.g. to vary the timing
+// of frames while keeping their sizes fixed. The seed has no effect on a noiser
+// set by WithFrameSizeNoiser.
+func WithSizeNoiseSeed(seed int64) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		sc.sizeNoiseSeed = &seed
+		return nil
+	}
 }
 
-// SetTargetBitrate sets the target bitrate to r bits per second. If r is
-// greater than c.rMax, bitrate will be set to c.rMax. If r is lower than
-// c.rMin, bitrate will be set to c.rMin.
-func (c *StatisticalCodec) SetTargetBitrate(r int) {
-	if r < c.targetBitrateBps {
-		c.targetBitrateBps = max(r, c.rMin)
-		return
+// WithDurationNoiseSeed seeds the default frame duration noiser with seed
+// instead of a value derived from the seed set by WithRandSeed. The seed has
+// no effect on a noiser set by WithFrameDurationNoiser.
+func WithDurationNoiseSeed(seed int64) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		sc.durationNoiseSeed = &seed
+		return nil
+	}
+}
+
+// WithRandSource derives the seed of the codec from src by drawing a single
+// value when the codec is constructed. Constructing several codecs in a fixed
+// order from one source, which was seeded with a master seed, gives each codec
+// an independent stream of random numbers and makes the whole scenario
+// reproducible from the master seed. A SimulcastCodec derives the seeds of its
+// layers from the drawn value. src is only used during construction and must
+// not be used concurrently.
+func WithRandSource(src rand.Source) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if src == nil {
+			return errors.New("rand source must not be nil")
+		}
+		sc.seed = src.Int63()
+		return nil
 	}
-	c.targetBitrateBps = min(r, c.rMax)
 }
 
-// NextFrame returns the next faked video frame
-func (c *StatisticalCodec) nextFrame() Frame {
-	duration := time.Duration((1.0/float64(c.fps))*1000.0) * time.Millisecond
+// WithFrameSizeNoiser replaces the default laplacian frame size noise by n.
+// The scale set by WithSizeNoiseScale and the seed set by WithRandSeed have no
+// effect on n.
+func WithFrameSizeNoiser(n Noiser) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if n == nil {
+			return errors.New("frame size noiser must not be nil")
+		}
+		sc.frameSizeNoiser = n
+		return nil
+	}
+}
 
-	if c.remainingBurstFrames == c.burstFrameCount {
-		return Frame{
-			Content:  make([]byte, c.burstFrameSize),
-			Duration: duration,
+// WithFrameDurationNoiser replaces the default laplacian frame interval noise
+// by n. The scale set by WithDurationNoiseScale and the seed set by
+// WithRandSeed have no effect on n.
+func WithFrameDurationNoiser(n Noiser) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if n == nil {
+			return errors.New("frame duration noiser must not be nil")
 		}
+		sc.frameDurationNoiser = n
+		return nil
 	}
+}
 
-	bytesPerFrame := c.targetBitrateBps / (8.0 * c.fps)
+// WithGOPSize enables key frames. The first frame after Start and every n-th
+// frame thereafter is a key frame. Frames of the transient burst following a
+// rate update are never key frames, a key frame falling due during the burst
+// is deferred to the first frame after it.
+func WithGOPSize(n int) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if n <= 0 {
+			return errors.New("GOP size must be positive")
+		}
+		sc.gopSize = n
+		return nil
+	}
+}
 
-	if c.remainingBurstFrames > 0 {
-		size := (c.targetBitrateBps * c.burstFrameCount) / (c.burstFrameSize + (c.burstFrameCount - 1))
+// WithKeyFrameSizeFactor sets the size of key frames relative to the average
+// size of the other frames.
+func WithKeyFrameSizeFactor(f float64) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if f <= 0 {
+			return errors.New("key frame size factor must be positive")
+		}
+		sc.keyFrameSizeFactor = f
+		return nil
+	}
+}
 
-		return Frame{
-			Content:  make([]byte, size),
-			Duration: duration,
+// WithKeyFrameOnRateChange makes the codec emit a key frame whenever the
+// target bitrate increases or decreases by more than factor, as encoders
+// commonly do on large rate switches. The key frame is emitted in addition to
+// the transient burst. factor must be greater than 1.
+func WithKeyFrameOnRateChange(factor float64) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if factor <= 1 {
+			return errors.New("key frame rate change factor must be greater than 1")
 		}
+		sc.keyFrameRateChangeFactor = factor
+		return nil
 	}
+}
 
-	noisedBytesPerFrame := math.Max(1, float64(bytesPerFrame)*(1-c.frameSizeNoiser.noise()))
-	noisedDuration := math.Max(0, float64(duration)*(1-c.frameDurationNoiser.noise()))
+// WithWriter sets the FrameWriter to which the codec writes frames, replacing
+// the writer passed to NewStatisticalEncoder.
+func WithWriter(w FrameWriter) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if w == nil {
+			return errors.New("writer must not be nil")
+		}
+		sc.writer = w
+		return nil
+	}
+}
 
-	return Frame{
-		Content:  make([]byte, int(noisedBytesPerFrame)),
-		Duration: time.Duration(noisedDuration),
+// WithMetricsCollector installs a Collector which observes every written frame
+// and every update of the target bitrate.
+func WithMetricsCollector(collector Collector) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if collector == nil {
+			return errors.New("metrics collector must not be nil")
+		}
+		sc.collector = collector
+		return nil
 	}
 }
 
-// Run starts the StatisticalCodec
-func (c *StatisticalCodec) Start() {
-	timer := time.NewTimer(c.t0)
-	for {
-		select {
-		case <-timer.C:
-			nextFrame := c.nextFrame()
-			timer.Reset(nextFrame.Duration)
-			c.writer.WriteFrame(nextFrame)
+// WithRateController installs a RateController which the codec consults after
+// writing each media frame to adapt its target bitrate.
+func WithRateController(rc RateController) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if rc == nil {
+			return errors.New("rate controller must not be nil")
+		}
+		sc.rateController = rc
+		return nil
+	}
+}
 
-		case rate := <-c.targetBitrateChan:
-			if time.Since(c.lastTargetBitrateUpdate) < c.tau {
-				continue
-			}
-			c.targetBitrateLock.Lock()
-			c.targetBitrateBps = rate
-			c.targetBitrateLock.Unlock()
-			c.lastTargetBitrateUpdate = time.Now()
-			c.remainingBurstFrames = c.burstFrameCount
+// WithFrameHook registers a hook which is called with every frame immediately
+// before it is written to the FrameWriter. The hook may modify the frame.
+// Multiple hooks are called in the order they were registered.
+func WithFrameHook(hook func(*Frame)) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if hook == nil {
+			return errors.New("frame hook must not be nil")
+		}
+		sc.frameHooks = append(sc.frameHooks, hook)
+		return nil
+	}
+}
 
-		case <-c.done:
-			return
+// WithConstantBitrate makes the codec emit frames of exactly
+// targetBitrateBps / (8 * fps) bytes at exactly 1/fps intervals. It disables
+// frame size and interval noise as well as the transient burst following rate
+// updates.
+func WithConstantBitrate() StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		sc.frameSizeNoiser = zeroNoise{}
+		sc.frameDurationNoiser = zeroNoise{}
+		sc.burstFrameCount = 0
+		return nil
+	}
+}
+
+// WithTemporalLayers tags frames with SVC temporal layer ids following a
+// dyadic pattern of count layers. Every 2^(count-1)-th frame is in the base
+// layer T0 and each higher layer doubles the frame rate.
+func WithTemporalLayers(count int) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if count <= 0 || count > maxTemporalLayers {
+			return fmt.Errorf("number of temporal layers must be in [1, %v]", maxTemporalLayers)
 		}
+		sc.temporalLayers = count
+		return nil
 	}
 }
 
-// Close stops and closes the StatisticalCodec
-func (c *StatisticalCodec) Close() error {
-	close(c.done)
-	return nil
+// WithSpatialLayers enables SVC spatial layers. The codec splits every picture
+// into one frame per spatial layer, where the size of each layer is
+// proportional to its fraction. Layers are ordered from the base layer to the
+// top layer. If the bitrate is too low to give every layer at least the
+// minimum bitrate of the codec, the codec sheds layers from the top, such that
+// the remaining layers share the bitrate. The base layer is never shed.
+func WithSpatialLayers(fractions []float64) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if len(fractions) == 0 {
+			return errors.New("spatial layers require at least one layer")
+		}
+		for _, f := range fractions {
+			if f <= 0 {
+				return errors.New("spatial layer fractions must be positive")
+			}
+		}
+		sc.spatialLayerShares = make([]float64, len(fractions))
+		copy(sc.spatialLayerShares, fractions)
+		return nil
+	}
+}
+
+// WithRateRamp makes the codec approach a new target bitrate gradually instead
+// of switching to it at once. After a target bitrate update, the bitrate used
+// to generate frames changes by step bits per second every interval until it
+// reaches the target. The transient burst still starts with the ramp.
+func WithRateRamp(step int, interval time.Duration) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if step <= 0 {
+			return errors.New("rate ramp step must be positive")
+		}
+		if interval <= 0 {
+			return errors.New("rate ramp interval must be positive")
+		}
+		sc.rampStep = step
+		sc.rampInterval = interval
+		return nil
+	}
+}
+
+// WithBitrateSmoothing filters target bitrate updates with an exponentially
+// weighted moving average, such that a new target r sets the target bitrate to
+// alpha*r + (1-alpha)*old. In contrast to WithRateRamp, which approaches a
+// single target over time, smoothing dampens rapidly oscillating targets.
+// alpha must be in (0, 1], where 1 disables smoothing.
+func WithBitrateSmoothing(alpha float64) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if alpha <= 0 || alpha > 1 {
+			return fmt.Errorf("bitrate smoothing factor %v out of range (0, 1]", alpha)
+		}
+		sc.bitrateSmoothing = alpha
+		return nil
+	}
+}
+
+// WithContentFill sets the pattern used to fill the content of generated
+// frames. Random content is generated from the seed set by WithRandSeed. The
+// default is ContentFillZero.
+func WithContentFill(fill ContentFill) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		switch fill {
+		case ContentFillZero, ContentFillRandom, ContentFillIncrementing:
+		default:
+			return fmt.Errorf("unknown content fill %v", fill)
+		}
+		sc.contentFill = fill
+		return nil
+	}
+}
+
+// WithBufferPool makes the codec allocate frame content from a pool of
+// buffers to reduce allocations. The FrameWriter owns each written frame until
+// it hands the frame back by calling ReleaseFrame on the codec. Writers which
+// never call ReleaseFrame are safe, but do not benefit from pooling.
+func WithBufferPool() StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		sc.bufferPool = &sync.Pool{
+			New: func() interface{} {
+				buf := []byte{}
+				return &buf
+			},
+		}
+		return nil
+	}
+}
+
+// WithMinFrameSize sets the size of the smallest frame in bytes the encoder
+// emits. If the target bitrate is too low to fill a frame of this size, the
+// encoder drops the frame instead and adds its size to the next frame, such
+// that the average bitrate still matches the target bitrate.
+func WithMinFrameSize(bytes int) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if bytes <= 0 {
+			return errors.New("min frame size must be positive")
+		}
+		sc.minFrameSize = bytes
+		return nil
+	}
+}
+
+// WithScheduleJitter decouples the timing of frame writes from the media
+// duration of frames. With schedule jitter, frames report their nominal
+// duration of 1/fps, while the interval between writing two frames is the
+// nominal duration perturbed by n. This models jitter in the encoder output
+// independent of the pacing of the content, e.g. a receiver playing out a
+// constant frame rate (CFR) stream that is sent with bursty timing. Frame
+// duration noise is not applied while schedule jitter is enabled, so the
+// durations of steady state frames are constant.
+func WithScheduleJitter(n Noiser) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if n == nil {
+			return errors.New("schedule jitter noiser must not be nil")
+		}
+		sc.scheduleJitter = n
+		return nil
+	}
+}
+
+// WithFixedSchedule writes frames on a fixed grid of nominal 1/fps intervals
+// starting at t0 after Start. Frame duration noise then only affects the
+// Duration reported in each frame and does not accumulate into a drift of the
+// write times. Late writes do not shift the grid; the following frame is
+// written at its original deadline. The fixed schedule takes precedence over
+// schedule jitter and an inter frame model for the timing of writes.
+func WithFixedSchedule() StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		sc.fixedSchedule = true
+		return nil
+	}
+}
+
+// WithClock replaces the clock the codec uses to schedule frames and rate
+// updates, e.g. to run the codec in virtual time.
+func WithClock(clock Clock) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if clock == nil {
+			return errors.New("clock must not be nil")
+		}
+		sc.clock = clock
+		return nil
+	}
+}
+
+// WithInterFrameModel replaces the constant frame rate by intervals drawn from
+// model. Each frame carries the bits the target bitrate allots to its
+// interval, and the frame duration noise is not applied. The frame rate set by
+// WithFramesPerSecond only determines the interval at which the codec checks
+// for updates while paused.
+func WithInterFrameModel(model InterFrameModel) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if model == nil {
+			return errors.New("inter frame model must not be nil")
+		}
+		sc.interFrameModel = model
+		return nil
+	}
+}
+
+// WithMaxFrames stops the codec after it generated n media frames. Dropped
+// frames and FEC frames do not count towards the limit.
+func WithMaxFrames(n int) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if n <= 0 {
+			return errors.New("max frames must be positive")
+		}
+		sc.maxFrames = n
+		return nil
+	}
+}
+
+// WithMaxDuration stops the codec d after Start was called.
+func WithMaxDuration(d time.Duration) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if d <= 0 {
+			return errors.New("max duration must be positive")
+		}
+		sc.maxDuration = d
+		return nil
+	}
+}
+
+// WithOnFinish installs a callback which is called when the codec stops
+// because the limit set by WithMaxFrames or WithMaxDuration was reached. The
+// callback is called from the run loop before Start returns.
+func WithOnFinish(f func()) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		sc.onFinish = f
+		return nil
+	}
+}
+
+// WithFEC makes the codec emit a FEC frame after every groupSize media
+// frames. The size of a FEC frame is overhead times the total size of the
+// media frames it protects. FEC frames have a duration of zero and consume a
+// sequence number.
+func WithFEC(groupSize int, overhead float64) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if groupSize <= 0 {
+			return errors.New("FEC group size must be positive")
+		}
+		if overhead <= 0 {
+			return errors.New("FEC overhead must be positive")
+		}
+		sc.fecGroupSize = groupSize
+		sc.fecOverhead = overhead
+		return nil
+	}
+}
+
+// WithStrictBounds enables strict mode. In strict mode, the codec still clamps
+// out of range frame sizes and durations generated by the model, but reports
+// each clamped value on the channel returned by Errors.
+func WithStrictBounds() StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		sc.errs = make(chan error, errorChannelSize)
+		return nil
+	}
+}
+
+// WithFrameChannel makes the codec send every frame on the channel returned by
+// Frames, which has a buffer of size frames. If the buffer is full, the codec
+// blocks until the frame is received. The writer passed to
+// NewStatisticalEncoder may be nil if the frame channel is enabled.
+func WithFrameChannel(size int) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if size < 0 {
+			return errors.New("frame channel size must not be negative")
+		}
+		sc.frames = make(chan Frame, size)
+		return nil
+	}
+}
+
+// WithErrorPolicy sets how the codec handles errors returned by its
+// FrameWriter. The default is ErrorPolicyCount.
+func WithErrorPolicy(policy ErrorPolicy) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if policy < ErrorPolicyCount || policy > ErrorPolicyStop {
+			return fmt.Errorf("invalid error policy %v", policy)
+		}
+		sc.errorPolicy = policy
+		return nil
+	}
+}
+
+// WithStatsWindow sets the length of the window of the windowed statistics
+// reported by Stats. The default is one second.
+func WithStatsWindow(d time.Duration) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if d <= 0 {
+			return errors.New("stats window must be positive")
+		}
+		sc.statsWindow = d
+		return nil
+	}
+}
+
+// WithWriteTimeout abandons writes which block for longer than d, such that a
+// slow writer does not stall frame generation and rate updates. An abandoned
+// frame counts as dropped in the statistics, although the writer may still
+// complete the write later. Until it does, the codec drops all further frames
+// without calling the writer, so the writer never sees concurrent or
+// reordered writes. An error returned by an abandoned write is handled under
+// the error policy once the codec notices the write completed. With a timeout,
+// the codec writes frames from a separate goroutine, which exits when the
+// codec is closed and the last write returned.
+func WithWriteTimeout(d time.Duration) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if d <= 0 {
+			return errors.New("write timeout must be positive")
+		}
+		sc.writeTimeout = d
+		return nil
+	}
+}
+
+// WithInitialTimerInterval sets the reference time interval t0, which is the
+// delay between starting the codec and emitting the first frame.
+func WithInitialTimerInterval(t0 time.Duration) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if t0 <= 0 {
+			return errors.New("initial timer interval must be positive")
+		}
+		sc.t0 = t0
+		return nil
+	}
+}
+
+// WithQuantizer replaces the bitrate driven frame size model by a quantizer
+// driven model, in which the average frame size is b0 * (32 / qp)^k for the
+// quantizer qp in [1, 127] and the exponent k set by WithQuantizerExponent.
+// The target bitrate no longer affects frame sizes, but rate controllers can
+// adjust the quantizer using SetQuantizer.
+func WithQuantizer(qp int) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if err := validateQP(qp); err != nil {
+			return err
+		}
+		sc.quantizer = qp
+		return nil
+	}
+}
+
+// WithQuantizerExponent sets the exponent k of the quantizer size model
+// enabled by WithQuantizer. The default is 1.
+func WithQuantizerExponent(k float64) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if k <= 0 {
+			return errors.New("quantizer exponent must be positive")
+		}
+		sc.quantizerExponent = k
+		return nil
+	}
+}
+
+func validateQP(qp int) error {
+	if qp < 1 || qp > maxQP {
+		return fmt.Errorf("quantizer %v out of range [1, %v]", qp, maxQP)
+	}
+	return nil
+}
+
+// WithReferenceFrameSize sets the reference frame size b0 in bytes, which is
+// the average frame size at quantizer 32 in the quantizer driven model.
+func WithReferenceFrameSize(b0 int) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if b0 <= 0 {
+			return errors.New("reference frame size must be positive")
+		}
+		sc.b0 = b0
+		return nil
+	}
+}
+
+// WithMaxFrameSize limits the size of steady state frames to bytes. If a
+// frame would exceed the limit, the encoder caps it and adds the excess to the
+// following frames, such that the average bitrate still matches the target
+// bitrate.
+func WithMaxFrameSize(bytes int) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if bytes <= 0 {
+			return errors.New("max frame size must be positive")
+		}
+		sc.maxFrameSize = bytes
+		return nil
+	}
+}
+
+// WithFrameSizeFloor sets the soft floor of noised steady state frame sizes,
+// which is one byte by default. If noise shrinks a steady state frame below
+// bytes, the encoder emits a frame of bytes and subtracts the deficit from the
+// following frames, such that the mean frame size is preserved even for large
+// noise.
+func WithFrameSizeFloor(bytes int) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if bytes <= 0 {
+			return errors.New("frame size floor must be positive")
+		}
+		sc.frameSizeFloor = bytes
+		return nil
+	}
+}
+
+// WithSizeNoiseScale sets the scale parameter of the zero-mean laplacian
+// distribution describing deviations in normalized frame size.
+func WithSizeNoiseScale(scale float64) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if scale < 0 {
+			return errors.New("size noise scale must not be negative")
+		}
+		sc.scaleB = scale
+		return nil
+	}
+}
+
+// WithDurationNoiseScale sets the scale parameter of the zero-mean laplacian
+// distribution describing deviations in normalized frame interval.
+func WithDurationNoiseScale(scale float64) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if scale < 0 {
+			return errors.New("duration noise scale must not be negative")
+		}
+		sc.scaleT = scale
+		return nil
+	}
+}
+
+// WithSizeNoiseSign sets how frame size noise scales the size of frames. The
+// default is NoiseSubtract.
+func WithSizeNoiseSign(sign NoiseSign) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if err := validateNoiseSign(sign); err != nil {
+			return err
+		}
+		sc.sizeNoiseSign = sign
+		return nil
+	}
+}
+
+// WithDurationNoiseSign sets how frame duration noise scales the duration of
+// frames. The default is NoiseSubtract.
+func WithDurationNoiseSign(sign NoiseSign) StatisticalCodecOption {
+	return func(sc *StatisticalCodec) error {
+		if err := validateNoiseSign(sign); err != nil {
+			return err
+		}
+		sc.durationNoiseSign = sign
+		return nil
+	}
+}
+
+func validateNoiseSign(sign NoiseSign) error {
+	if sign != NoiseSubtract && sign != NoiseAdd {
+		return fmt.Errorf("invalid noise sign %v", sign)
+	}
+	return nil
+}
+
+// WithScaleB sets the scale of the default laplacian frame size noise.
+//
+// Deprecated: Use WithSizeNoiseScale.
+func WithScaleB(scale float64) StatisticalCodecOption {
+	return WithSizeNoiseScale(scale)
+}
+
+// WithScaleT sets the scale of the default laplacian frame interval noise.
+//
+// Deprecated: Use WithDurationNoiseScale.
+func WithScaleT(scale float64) StatisticalCodecOption {
+	return WithDurationNoiseScale(scale)
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// steadyStateFrameBytes returns the size in bytes of a steady state frame of a
+// stream of fps frames per second at bitrateBps bits per second. It computes
+// in 64 bits, so it does not overflow for any int bitrate on 32 bit platforms.
+func steadyStateFrameBytes(bitrateBps, fps int) int {
+	return int(int64(bitrateBps) / (8 * int64(fps)))
+}
+
+// clampBitrate limits r to the range supported by the encoder.
+func (c *StatisticalCodec) clampBitrate(r int) int {
+	return min(max(r, c.rMin), c.rMax)
+}
+
+// NewStatisticalEncoder returns a StatisticalCodec writing frames to w. w may
+// be nil if a writer is set by WithWriter or frames are consumed from the
+// channel enabled by WithFrameChannel, otherwise NewStatisticalEncoder returns
+// an error.
+func NewStatisticalEncoder(w FrameWriter, opts ...StatisticalCodecOption) (*StatisticalCodec, error) {
+	sc := &StatisticalCodec{
+		targetBitrateBps:         defaultTargetBitrateBps,
+		fps:                      defaultFPS,
+		tau:                      defaultTau,
+		burstFrameCount:          defaultBurstFrameCount,
+		burstFrameSize:           defaultBurstFrameSize,
+		t0:                       defaultT0,
+		b0:                       defaultB0,
+		quantizerExponent:        defaultQuantizerExponent,
+		rMin:                     defaultRMin,
+		rMax:                     defaultRMax,
+		writer:                   w,
+		collector:                nopCollector{},
+		rateController:           nopRateController{},
+		frameHooks:               []func(*Frame){},
+		scaleB:                   defaultScaleB,
+		scaleT:                   defaultScaleT,
+		sizeNoiseSign:            NoiseSubtract,
+		durationNoiseSign:        NoiseSubtract,
+		seed:                     defaultSeed(),
+		sizeNoiseSeed:            nil,
+		durationNoiseSeed:        nil,
+		transientShape:           TransientSquare,
+		minBurstInterval:         0,
+		burstDecayFrames:         0,
+		noiseDuringBurst:         false,
+		gopSize:                  0,
+		keyFrameSizeFactor:       defaultKeyFrameSizeFactor,
+		keyFrameRateChangeFactor: 0,
+		temporalLayers:           1,
+		spatialLayerShares:       nil,
+		contentFill:              ContentFillZero,
+		bufferPool:               nil,
+		minFrameSize:             0,
+		maxFrameSize:             0,
+		frameSizeFloor:           defaultFrameSizeFloor,
+		scheduleJitter:           nil,
+		fixedSchedule:            false,
+		clock:                    realClock{},
+		interFrameModel:          nil,
+		maxFrames:                0,
+		maxDuration:              0,
+		onFinish:                 nil,
+		fecGroupSize:             0,
+		fecOverhead:              0,
+		errs:                     nil,
+		frames:                   nil,
+		statsWindow:              defaultStatsWindow,
+		writeTimeout:             0,
+		errorPolicy:              ErrorPolicyCount,
+		rampStep:                 0,
+		rampInterval:             0,
+		bitrateSmoothing:         0,
+		lock:                     sync.Mutex{},
+		keyFrameRequested:        false,
+		paused:                   false,
+		state:                    stateCreated,
+		stopped:                  nil,
+		flushOnClose:             false,
+		framesClosed:             false,
+		requestedBitrateBps:      0,
+		schedule:                 nil,
+		quantizer:                0,
+		effectiveBitrateBps:      0,
+		lastRampUpdate:           time.Time{},
+		stats:                    CodecStats{},
+		window:                   nil,
+		lastBitrateChange:        time.Time{},
+		nextFrameAt:              time.Time{},
+		targetBitrateChan:        make(chan int, 1),
+		lastTargetBitrateUpdate:  time.Time{},
+		rnd:                      nil,
+		remainingBurstFrames:     0,
+		lastBurstEnd:             time.Time{},
+		remainingDecayFrames:     0,
+		keyFrameDeferred:         false,
+		carryBytes:               0,
+		fecGroupFrames:           0,
+		fecGroupBytes:            0,
+		writeQueue:               nil,
+		writeResults:             nil,
+		writePending:             false,
+		pendingFrame:             Frame{},
+		flushing:                 false,
+		frameCount:               0,
+		seqNr:                    0,
+		pts:                      0,
+		followers:                nil,
+		frameSizeNoiser:          nil,
+		frameDurationNoiser:      nil,
+		done:                     make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		if err := opt(sc); err != nil {
+			return nil, err
+		}
+	}
+
+	if sc.writer == nil && sc.frames == nil {
+		return nil, errors.New("writer must not be nil")
+	}
+
+	if sc.targetBitrateBps < sc.rMin || sc.targetBitrateBps > sc.rMax {
+		return nil, fmt.Errorf("initial target bitrate %v bps out of range [%v, %v]", sc.targetBitrateBps, sc.rMin, sc.rMax)
+	}
+
+	// Start the write worker only once all checks passed, since a failed
+	// construction has no Close to stop it.
+	if sc.writer != nil && sc.writeTimeout > 0 {
+		sc.writeQueue = make(chan Frame, 1)
+		sc.writeResults = make(chan error, 1)
+		go sc.writeLoop()
+	}
+
+	sc.rnd = rand.New(rand.NewSource(sc.seed))
+	// The seeds are always drawn, such that overriding one of them does not
+	// change the other streams derived from seed.
+	sizeNoiseSource := rand.NewSource(sc.rnd.Int63())
+	durationNoiseSource := rand.NewSource(sc.rnd.Int63())
+	if sc.sizeNoiseSeed != nil {
+		sizeNoiseSource = rand.NewSource(*sc.sizeNoiseSeed)
+	}
+	if sc.durationNoiseSeed != nil {
+		durationNoiseSource = rand.NewSource(*sc.durationNoiseSeed)
+	}
+	if sc.frameSizeNoiser == nil {
+		sc.frameSizeNoiser = NewLaplaceNoiser(sc.scaleB, sizeNoiseSource)
+	}
+	if sc.frameDurationNoiser == nil {
+		sc.frameDurationNoiser = NewLaplaceNoiser(sc.scaleT, durationNoiseSource)
+	}
+	sc.SetTargetBitrate(sc.targetBitrateBps)
+	sc.effectiveBitrateBps = sc.targetBitrateBps
+
+	return sc, nil
+}
+
+// GetTargetBitrate returns the target bitrate in bit per second last requested
+// by SetTargetBitrate or an accepted rate update, before it is clamped to the
+// rate bounds and smoothed.
+func (c *StatisticalCodec) GetTargetBitrate() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.requestedBitrateBps
+}
+
+// GetEffectiveBitrate returns the bitrate in bits per second the codec used
+// to generate the latest frame. It differs from the target bitrate if the
+// requested bitrate was clamped to the rate bounds or smoothed by
+// WithBitrateSmoothing, and while the codec ramps towards a new target bitrate
+// configured by WithRateRamp.
+func (c *StatisticalCodec) GetEffectiveBitrate() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.effectiveBitrateBps
+}
+
+// CurrentPhase returns the phase of the codec as of the latest written frame
+// or accepted rate update. A transient burst takes precedence over a rate ramp
+// running at the same time. It is safe to call CurrentPhase concurrently with
+// Start.
+func (c *StatisticalCodec) CurrentPhase() Phase {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	switch {
+	case c.stats.RemainingBurstFrames > 0:
+		return PhaseBurst
+	case c.rampStep > 0 && c.effectiveBitrateBps != c.targetBitrateBps:
+		return PhaseRamp
+	default:
+		return PhaseSteady
+	}
+}
+
+// NextFrameIn returns the approximate time until the run loop generates the
+// next frame. It returns 0 if the codec is not running or the next frame is
+// overdue. While the codec is paused, it returns the time until the codec
+// checks again whether it was resumed.
+func (c *StatisticalCodec) NextFrameIn() time.Duration {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.state != stateRunning {
+		return 0
+	}
+	if d := c.nextFrameAt.Sub(c.clock.Now()); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// SetTargetBitrate sets the target bitrate to r bits per second. If r is
+// greater than c.rMax, bitrate will be set to c.rMax. If r is lower than
+// c.rMin, bitrate will be set to c.rMin. The new bitrate intentionally
+// bypasses the reaction latency tau and the transient burst and applies from
+// the next frame on, unless a rate ramp is configured. It is safe to call
+// SetTargetBitrate concurrently with Start.
+func (c *StatisticalCodec) SetTargetBitrate(r int) {
+	c.lock.Lock()
+	c.requestedBitrateBps = r
+	c.setTargetBitrateLocked(c.clampBitrate(r))
+	c.lastBitrateChange = c.clock.Now()
+	bps := c.targetBitrateBps
+	c.lock.Unlock()
+
+	c.collector.ObserveBitrateUpdate(bps)
+}
+
+// Stats returns a snapshot of the codec statistics.
+func (c *StatisticalCodec) Stats() CodecStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := c.clock.Now()
+	c.pruneWindowLocked(now)
+	stats := c.stats
+	stats.TargetBitrate = c.targetBitrateBps
+	stats.SinceLastBitrateUpdate = now.Sub(c.lastBitrateChange)
+	stats.Window = c.statsWindow
+	for _, r := range c.window {
+		stats.WindowFrames++
+		stats.WindowBytes += uint64(r.size)
+	}
+	return stats
+}
+
+// Frames returns the channel enabled by WithFrameChannel, on which the codec
+// sends every frame it writes, or nil if the channel is disabled. The channel
+// is closed when the codec is closed, so consumers can range over it.
+func (c *StatisticalCodec) Frames() <-chan Frame {
+	return c.frames
+}
+
+// Errors returns the channel on which the codec reports a BoundsError for every
+// value clamped in strict mode. If strict mode is disabled, Errors returns nil.
+// Errors are dropped if the channel is full.
+func (c *StatisticalCodec) Errors() <-chan error {
+	return c.errs
+}
+
+// GetFPS returns the current frame rate in frames per second.
+func (c *StatisticalCodec) GetFPS() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.fps
+}
+
+// SetFPS changes the frame rate of the codec to fps frames per second. The new
+// frame rate applies from the next generated frame on. It is safe to call
+// SetFPS concurrently with Start.
+func (c *StatisticalCodec) SetFPS(fps int) error {
+	if err := validateFPS(fps); err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.fps = fps
+	return nil
+}
+
+// SetQuantizer sets the quantizer of the quantizer driven frame size model,
+// see WithQuantizer. If the codec was created without WithQuantizer,
+// SetQuantizer switches it to the quantizer driven model. The new quantizer
+// applies from the next generated frame on. It is safe to call SetQuantizer
+// concurrently with Start.
+func (c *StatisticalCodec) SetQuantizer(qp int) error {
+	if err := validateQP(qp); err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.quantizer = qp
+	return nil
+}
+
+// TriggerKeyFrame makes the codec emit a key frame as the next frame, e.g. to
+// model a scene change. The key frame does not affect the cadence of periodic
+// key frames configured by WithGOPSize. It is safe to call TriggerKeyFrame
+// concurrently with Start.
+func (c *StatisticalCodec) TriggerKeyFrame() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.keyFrameRequested = true
+}
+
+// Pause suspends frame generation until Resume is called. The state of the
+// codec, including the random number generators, is retained while paused.
+func (c *StatisticalCodec) Pause() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.paused = true
+}
+
+// Resume continues frame generation after Pause. The next frame is generated
+// within one frame interval.
+func (c *StatisticalCodec) Resume() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.paused = false
+}
+
+// ReleaseFrame returns the content buffer of f to the buffer pool of the codec
+// if pooling was enabled by WithBufferPool, and has no effect otherwise. f must
+// have been generated by c and neither f.Content nor any other reference to
+// the buffer, including copies of f, may be used after ReleaseFrame returns.
+func (c *StatisticalCodec) ReleaseFrame(f Frame) {
+	if c.bufferPool == nil || f.Content == nil {
+		return
+	}
+	buf := f.Content[:cap(f.Content)]
+	c.bufferPool.Put(&buf)
+}
+
+// ScheduleBitrate sets a timeline of target bitrate updates, which the codec
+// applies relative to the time Start is called. Scheduled updates are handled
+// like updates requested by RequestTargetBitrate, i.e. they respect the
+// reaction latency tau and start a transient burst. The schedule takes effect
+// at the next call to Start and replaces any previous schedule.
+func (c *StatisticalCodec) ScheduleBitrate(events []BitrateEvent) {
+	schedule := make([]BitrateEvent, len(events))
+	copy(schedule, events)
+	sort.SliceStable(schedule, func(i, j int) bool {
+		return schedule[i].Offset < schedule[j].Offset
+	})
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.schedule = schedule
+}
+
+// RequestTargetBitrate asks the encoder to change its target bitrate to r bits
+// per second. In contrast to SetTargetBitrate, the request is handled like a
+// rate update of a real encoder: Requests arriving within the reaction latency
+// tau of the previously accepted update are ignored, and accepted updates
+// start a transient burst. RequestTargetBitrate never blocks. If an earlier
+// request has not been processed yet, it is replaced by r.
+func (c *StatisticalCodec) RequestTargetBitrate(r int) {
+	select {
+	case <-c.targetBitrateChan:
+	default:
+	}
+	select {
+	case c.targetBitrateChan <- r:
+	default:
+	}
+}
+
+// NextFrame returns the next faked video frame. If the encoder drops the
+// frame, nextFrame returns false and a frame without content whose duration is
+// the time until the next frame.
+func (c *StatisticalCodec) nextFrame() (Frame, bool) {
+	now := c.clock.Now()
+	c.lock.Lock()
+	c.updateEffectiveBitrate(now)
+	bitrateBps := c.effectiveBitrateBps
+	fps := c.fps
+	qp := c.quantizer
+	keyFrameRequested := c.keyFrameRequested
+	c.keyFrameRequested = false
+	c.lock.Unlock()
+
+	duration := time.Duration(float64(time.Second) / float64(fps))
+	bytesPerFrame := steadyStateFrameBytes(bitrateBps, fps)
+	if c.interFrameModel != nil {
+		duration = c.interFrameModel.NextDuration()
+		bytesPerFrame = int(float64(bitrateBps) * duration.Seconds() / 8)
+	}
+	if qp > 0 {
+		bytesPerFrame = int(float64(c.b0) * math.Pow(float64(referenceQP)/float64(qp), c.quantizerExponent))
+	}
+
+	// During the transient period following a rate update, the encoder emits
+	// burstFrameCount frames, whose sizes are determined by the transient
+	// shape. Each burst frame decrements remainingBurstFrames, so the encoder
+	// returns to steady state after exactly burstFrameCount burst frames.
+	// Requested key frames take precedence and do not count as burst frames,
+	// while periodic key frames due during the burst are deferred until the
+	// burst ended.
+	var frame Frame
+	switch {
+	case keyFrameRequested:
+		c.keyFrameDeferred = false
+		frame = c.keyFrame(bytesPerFrame, duration)
+
+	case c.remainingBurstFrames > 0:
+		if c.keyFrameDue() {
+			c.keyFrameDeferred = true
+		}
+		k := c.burstFrameCount - c.remainingBurstFrames
+		c.remainingBurstFrames--
+		if c.remainingBurstFrames == 0 {
+			c.remainingDecayFrames = c.burstDecayFrames
+			c.lastBurstEnd = now
+		}
+		size := c.transientFrameSize(k, bytesPerFrame)
+		if size < 0 {
+			// Pay the deficit down over the next steady state frames, such
+			// that all transient shapes spend the same budget.
+			c.carryBytes += size
+			size = int(c.lowerBound("burst frame size", float64(size), 0))
+		}
+		frame = c.burstFrame(size, duration)
+
+	case c.keyFrameDeferred || c.keyFrameDue():
+		c.keyFrameDeferred = false
+		frame = c.keyFrame(bytesPerFrame, duration)
+
+	default:
+		size := c.noisedFrameSize(bytesPerFrame) + c.decayBytes(bytesPerFrame) + c.carryBytes
+		c.carryBytes = 0
+		if size < c.frameSizeFloor {
+			// Borrow the deficit from the next frames.
+			c.carryBytes = size - c.frameSizeFloor
+			size = int(c.lowerBound("frame size", float64(size), float64(c.frameSizeFloor)))
+		}
+		if size < c.minFrameSize {
+			// Drop the frame and spend its budget on the next frame.
+			c.carryBytes += size
+			c.pts += duration
+			return Frame{Duration: duration}, false
+		}
+		if c.maxFrameSize > 0 && size > c.maxFrameSize {
+			// Pay the excess down over the next frames.
+			c.carryBytes += size - c.maxFrameSize
+			size = c.maxFrameSize
+		}
+		frame = Frame{
+			Content:  c.newContent(size),
+			Duration: c.noisedDuration(duration),
+		}
+	}
+
+	frame.SeqNr = c.seqNr
+	frame.CaptureTime = now
+	frame.TargetBitrate = bitrateBps
+	frame.TemporalLayerID = c.temporalLayerID(c.frameCount)
+	frame.PTS = c.pts
+	c.pts += frame.Duration
+	c.frameCount++
+	c.seqNr++
+	return frame, true
+}
+
+// updateEffectiveBitrate moves the effective bitrate towards the target
+// bitrate. Without a rate ramp, the effective bitrate follows the target
+// bitrate immediately. Otherwise, it changes by rampStep for every
+// rampInterval elapsed since the last step. c.lock must be held.
+func (c *StatisticalCodec) updateEffectiveBitrate(now time.Time) {
+	if c.rampStep == 0 {
+		c.effectiveBitrateBps = c.targetBitrateBps
+		return
+	}
+	if c.effectiveBitrateBps == c.targetBitrateBps {
+		c.lastRampUpdate = now
+		return
+	}
+	steps := int64(now.Sub(c.lastRampUpdate) / c.rampInterval)
+	if steps == 0 {
+		return
+	}
+	c.lastRampUpdate = c.lastRampUpdate.Add(time.Duration(steps) * c.rampInterval)
+	delta := steps * int64(c.rampStep)
+	gap := int64(c.targetBitrateBps) - int64(c.effectiveBitrateBps)
+	switch {
+	case gap > 0 && delta < gap:
+		c.effectiveBitrateBps += int(delta)
+	case gap < 0 && delta < -gap:
+		c.effectiveBitrateBps -= int(delta)
+	default:
+		c.effectiveBitrateBps = c.targetBitrateBps
+	}
+}
+
+// newContent returns a frame content buffer of size bytes filled according to
+// c.contentFill.
+func (c *StatisticalCodec) newContent(size int) []byte {
+	if c.bufferPool == nil {
+		content := make([]byte, size)
+		c.fillContent(content, false)
+		return content
+	}
+	buf := c.bufferPool.Get().(*[]byte)
+	if cap(*buf) < size {
+		*buf = make([]byte, size)
+	}
+	content := (*buf)[:size]
+	c.fillContent(content, true)
+	return content
+}
+
+// fillContent fills content according to c.contentFill. If dirty is false,
+// content is known to be zeroed already.
+func (c *StatisticalCodec) fillContent(content []byte, dirty bool) {
+	switch c.contentFill {
+	case ContentFillZero:
+		if dirty {
+			for i := range content {
+				content[i] = 0
+			}
+		}
+	case ContentFillRandom:
+		c.rnd.Read(content)
+	case ContentFillIncrementing:
+		for i := range content {
+			content[i] = byte(i)
+		}
+	}
+}
+
+// fecFrame adds the media frame f to the current FEC group. If the group is
+// complete, fecFrame returns a FEC frame protecting the group, which is written
+// directly after f.
+func (c *StatisticalCodec) fecFrame(f Frame) (Frame, bool) {
+	if c.fecGroupSize == 0 {
+		return Frame{}, false
+	}
+	c.fecGroupFrames++
+	c.fecGroupBytes += int64(len(f.Content))
+	if c.fecGroupFrames < c.fecGroupSize {
+		return Frame{}, false
+	}
+	fec := Frame{
+		Content:       c.newContent(int(float64(c.fecGroupBytes) * c.fecOverhead)),
+		Duration:      0,
+		SeqNr:         c.seqNr,
+		PTS:           f.PTS,
+		CaptureTime:   f.CaptureTime,
+		TargetBitrate: f.TargetBitrate,
+		IsFEC:         true,
+	}
+	c.seqNr++
+	c.fecGroupFrames = 0
+	c.fecGroupBytes = 0
+	return fec, true
+}
+
+// transientFrameSize returns the size of the k-th frame of the transient burst.
+// The overshoot of the burst, i.e. burstFrameSize minus the steady state frame
+// size, is distributed over the burst frames according to the transient shape
+// and compensated evenly by all burst frames but the first, such that the
+// burst spends the budget of burstFrameCount steady state frames. With the
+// default square shape, the first frame is a large frame of burstFrameSize
+// bytes (see section 5.2 of RFC 8593). At low bitrates, the size of the
+// compensating frames may be negative, nextFrame carries the deficit over to
+// the following steady state frames.
+func (c *StatisticalCodec) transientFrameSize(k, bytesPerFrame int) int {
+	if c.transientShape == TransientSquare {
+		if k == 0 {
+			return c.burstFrameSize
+		}
+		budget := int64(c.burstFrameCount)*int64(bytesPerFrame) - int64(c.burstFrameSize)
+		return int(budget / int64(c.burstFrameCount-1))
+	}
+	overshoot := float64(c.burstFrameSize - bytesPerFrame)
+	size := float64(bytesPerFrame) + overshoot*c.transientWeight(k)
+	if k > 0 {
+		size -= overshoot / float64(c.burstFrameCount-1)
+	}
+	return int(size)
+}
+
+// transientWeight returns the share of the overshoot of the transient burst
+// spent on the k-th burst frame. The weights of all burst frames add up to 1.
+func (c *StatisticalCodec) transientWeight(k int) float64 {
+	n := float64(c.burstFrameCount)
+	switch c.transientShape {
+	case TransientLinear:
+		return (n - float64(k)) / (n * (n + 1) / 2)
+	case TransientExponential:
+		return math.Pow(0.5, float64(k)) / (2 * (1 - math.Pow(0.5, n)))
+	default:
+		if k == 0 {
+			return 1
+		}
+		return 0
+	}
+}
+
+// decayBytes returns the bytes added to the next steady state frame while the
+// frame size settles after a transient burst.
+func (c *StatisticalCodec) decayBytes(bytesPerFrame int) int {
+	if c.remainingDecayFrames == 0 {
+		return 0
+	}
+	extra := float64(c.burstFrameSize-bytesPerFrame) * float64(c.remainingDecayFrames) / float64(c.burstDecayFrames+1)
+	c.remainingDecayFrames--
+	return int(c.lowerBound("decay bytes", extra, 0))
+}
+
+// burstFrame returns a frame of the transient burst. Burst frames are only
+// noised if enabled by WithNoiseDuringBurst.
+func (c *StatisticalCodec) burstFrame(size int, duration time.Duration) Frame {
+	if !c.noiseDuringBurst {
+		return Frame{
+			Content:  c.newContent(size),
+			Duration: duration,
+		}
+	}
+	return Frame{
+		Content:  c.newContent(int(c.noised("frame size", float64(size), c.sizeNoiseSign, c.frameSizeNoiser))),
+		Duration: c.noisedDuration(duration),
+	}
+}
+
+func (c *StatisticalCodec) keyFrame(bytesPerFrame int, duration time.Duration) Frame {
+	size := c.keyFrameSizeFactor * float64(bytesPerFrame)
+	return Frame{
+		Content:    c.newContent(int(size)),
+		Duration:   c.noisedDuration(duration),
+		IsKeyFrame: true,
+	}
+}
+
+// temporalLayerID returns the temporal layer of the frame with sequence number
+// seqNr in a dyadic layer structure, e.g. T0 T2 T1 T2 T0 ... for three layers.
+func (c *StatisticalCodec) temporalLayerID(seqNr uint64) int {
+	period := uint64(1) << (c.temporalLayers - 1)
+	i := seqNr % period
+	if i == 0 {
+		return 0
+	}
+	return c.temporalLayers - 1 - bits.TrailingZeros64(i)
+}
+
+// keyFrameDue reports whether the next frame starts a new group of pictures.
+// The first frame after Start always starts a group of pictures.
+func (c *StatisticalCodec) keyFrameDue() bool {
+	return c.gopSize > 0 && c.frameCount%uint64(c.gopSize) == 0
+}
+
+// noisedDuration returns the duration of a steady state frame. If schedule
+// jitter or an inter frame model is enabled, frames report their nominal
+// duration.
+func (c *StatisticalCodec) noisedDuration(duration time.Duration) time.Duration {
+	if c.scheduleJitter != nil || c.interFrameModel != nil {
+		return duration
+	}
+	return time.Duration(c.noised("frame duration", float64(duration), c.durationNoiseSign, c.frameDurationNoiser))
+}
+
+// noisedFrameSize returns the noised size of a steady state frame, which may
+// be negative. nextFrame applies the soft floor to it.
+func (c *StatisticalCodec) noisedFrameSize(bytesPerFrame int) int {
+	return int(float64(bytesPerFrame) * c.sizeNoiseSign.factor(c.frameSizeNoiser.Noise()))
+}
+
+// noised scales v by a sample of n according to sign. Noise samples which would
+// make the scaling factor negative are clamped, such that the result is never
+// negative.
+func (c *StatisticalCodec) noised(quantity string, v float64, sign NoiseSign, n Noiser) float64 {
+	return v * c.lowerBound(quantity+" noise factor", sign.factor(n.Noise()), 0)
+}
+
+// lowerBound returns v clamped to be at least bound. In strict mode, clamping
+// is reported as a BoundsError on the error channel.
+func (c *StatisticalCodec) lowerBound(quantity string, v, bound float64) float64 {
+	if v >= bound {
+		return v
+	}
+	if c.errs != nil {
+		select {
+		case c.errs <- &BoundsError{
+			SeqNr:    c.seqNr,
+			Quantity: quantity,
+			Value:    v,
+			Bound:    bound,
+		}:
+		default:
+		}
+	}
+	return bound
+}
+
+// scheduleInterval returns the time to wait after writing frame f before
+// writing the next frame.
+func (c *StatisticalCodec) scheduleInterval(f Frame) time.Duration {
+	if c.scheduleJitter == nil {
+		return f.Duration
+	}
+	return time.Duration(c.noised("schedule interval", float64(f.Duration), NoiseSubtract, c.scheduleJitter))
+}
+
+// Start runs the StatisticalCodec and writes frames to the FrameWriter until
+// Close is called or a limit set by WithMaxFrames or WithMaxDuration is
+// reached. Start blocks, so it is usually run in its own goroutine, or
+// replaced by StartAsync. Start returns immediately if the codec is already
+// running or was closed.
+func (c *StatisticalCodec) Start() {
+	c.StartWithContext(context.Background())
+}
+
+// StartWithContext runs the StatisticalCodec like Start, but additionally
+// returns as soon as ctx is cancelled.
+func (c *StatisticalCodec) StartWithContext(ctx context.Context) {
+	stopped, err := c.setRunning()
+	if err != nil {
+		return
+	}
+	c.run(ctx, stopped)
+}
+
+// StartAsync runs the StatisticalCodec like Start in a new goroutine and
+// returns immediately. The codec is already running when StartAsync returns
+// and stops when Close is called. StartAsync returns an error if the codec is
+// already running or was closed.
+func (c *StatisticalCodec) StartAsync() error {
+	stopped, err := c.setRunning()
+	if err != nil {
+		return err
+	}
+	go c.run(context.Background(), stopped)
+	return nil
+}
+
+// setRunning moves the codec into the running state and returns the channel
+// the run loop closes when it returns.
+func (c *StatisticalCodec) setRunning() (chan struct{}, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	switch c.state {
+	case stateRunning:
+		return nil, errors.New("codec already running")
+	case stateClosed:
+		return nil, errors.New("codec closed")
+	}
+	c.state = stateRunning
+	c.stopped = make(chan struct{})
+	return c.stopped, nil
+}
+
+// run is the run loop of the codec. It closes stopped when it returns.
+func (c *StatisticalCodec) run(ctx context.Context, stopped chan struct{}) {
+	defer func() {
+		c.lock.Lock()
+		if c.state == stateRunning {
+			c.state = stateCreated
+		} else {
+			c.closeFramesLocked()
+		}
+		c.lock.Unlock()
+		close(stopped)
+	}()
+
+	c.frameCount = 0
+	c.seqNr = 0
+	c.pts = 0
+
+	start := c.clock.Now()
+	// The initial target bitrate counts as the first accepted update.
+	c.lastTargetBitrateUpdate = start
+	timer := c.clock.NewTimer(c.t0)
+	defer timer.Stop()
+	c.setNextFrameAt(start.Add(c.t0))
+	deadline := start.Add(c.t0)
+
+	c.lock.Lock()
+	schedule := c.schedule
+	c.lock.Unlock()
+	nextEvent := 0
+	var scheduleTimer Timer
+	var scheduleC <-chan time.Time
+	if len(schedule) > 0 {
+		scheduleTimer = c.clock.NewTimer(schedule[0].Offset)
+		defer scheduleTimer.Stop()
+		scheduleC = scheduleTimer.C()
+	}
+	var limitC <-chan time.Time
+	if c.maxDuration > 0 {
+		limitTimer := c.clock.NewTimer(c.maxDuration)
+		defer limitTimer.Stop()
+		limitC = limitTimer.C()
+	}
+
+	for {
+		select {
+		case <-timer.C():
+			c.lock.Lock()
+			paused := c.paused
+			fps := c.fps
+			c.lock.Unlock()
+			nominal := time.Duration(float64(time.Second) / float64(fps))
+			if c.fixedSchedule {
+				deadline = deadline.Add(nominal)
+				timer.Reset(deadline.Sub(c.clock.Now()))
+				c.setNextFrameAt(deadline)
+			}
+			if paused {
+				if !c.fixedSchedule {
+					timer.Reset(nominal)
+					c.setNextFrameAt(c.clock.Now().Add(nominal))
+				}
+				continue
+			}
+			pts := c.pts
+			nextFrame, ok := c.nextFrame()
+			if !c.fixedSchedule {
+				interval := c.scheduleInterval(nextFrame)
+				timer.Reset(interval)
+				c.setNextFrameAt(c.clock.Now().Add(interval))
+			}
+			if ok {
+				c.emit(nextFrame)
+			}
+			c.driveFollowers(pts, nextFrame.Duration)
+			if !ok {
+				continue
+			}
+			if c.maxFrames > 0 && c.frameCount >= uint64(c.maxFrames) {
+				c.finish()
+				return
+			}
+
+		case rate := <-c.targetBitrateChan:
+			c.updateTargetBitrate(rate)
+
+		case <-scheduleC:
+			c.updateTargetBitrate(schedule[nextEvent].TargetBitrate)
+			nextEvent++
+			if nextEvent < len(schedule) {
+				scheduleTimer.Reset(schedule[nextEvent].Offset - c.clock.Now().Sub(start))
+			} else {
+				scheduleC = nil
+			}
+
+		case <-limitC:
+			c.finish()
+			return
+
+		case <-ctx.Done():
+			return
+
+		case <-c.done:
+			c.lock.Lock()
+			flush := c.flushOnClose
+			c.lock.Unlock()
+			if flush {
+				c.flushBurst()
+			}
+			return
+		}
+	}
+}
+
+// driveFollowers makes every follower generate and emit its next frame with
+// the PTS and duration of the frame the codec generated at pts, such that all
+// followers share the frame schedule of the codec.
+func (c *StatisticalCodec) driveFollowers(pts, duration time.Duration) {
+	for _, follower := range c.followers {
+		f, ok := follower.nextFrame()
+		follower.pts = pts + duration
+		if !ok {
+			continue
+		}
+		f.PTS = pts
+		f.Duration = duration
+		follower.emit(f)
+	}
+}
+
+// setNextFrameAt records the time the frame timer of the run loop fires next.
+func (c *StatisticalCodec) setNextFrameAt(t time.Time) {
+	c.lock.Lock()
+	c.nextFrameAt = t
+	c.lock.Unlock()
+}
+
+// flushBurst writes the remaining frames of the current transient burst
+// without waiting for their scheduled time.
+func (c *StatisticalCodec) flushBurst() {
+	c.flushing = true
+	defer func() {
+		c.flushing = false
+	}()
+	for c.remainingBurstFrames > 0 {
+		f, ok := c.nextFrame()
+		if !ok {
+			continue
+		}
+		c.emit(f)
+	}
+}
+
+// finish closes the codec after a limit was reached and notifies the OnFinish
+// callback.
+func (c *StatisticalCodec) finish() {
+	c.Close()
+	if c.onFinish != nil {
+		c.onFinish()
+	}
+}
+
+// burstAllowed reports whether a rate update at now may start a transient
+// burst according to the minimum burst interval.
+func (c *StatisticalCodec) burstAllowed(now time.Time) bool {
+	if c.minBurstInterval == 0 {
+		return true
+	}
+	if c.remainingBurstFrames > 0 {
+		return false
+	}
+	return c.lastBurstEnd.IsZero() || now.Sub(c.lastBurstEnd) >= c.minBurstInterval
+}
+
+// updateTargetBitrate handles a rate update like a real encoder: Updates
+// within tau of the previously accepted update are ignored, accepted updates
+// start a transient burst.
+func (c *StatisticalCodec) updateTargetBitrate(rate int) {
+	now := c.clock.Now()
+	if c.tau > 0 && now.Sub(c.lastTargetBitrateUpdate) < c.tau {
+		return
+	}
+	c.lastTargetBitrateUpdate = now
+	if c.burstAllowed(now) {
+		c.remainingBurstFrames = c.burstFrameCount
+		c.remainingDecayFrames = 0
+	}
+	c.lock.Lock()
+	c.requestedBitrateBps = rate
+	c.setTargetBitrateLocked(c.clampBitrate(rate))
+	c.lastBitrateChange = c.lastTargetBitrateUpdate
+	c.stats.RemainingBurstFrames = c.remainingBurstFrames
+	bps := c.targetBitrateBps
+	c.lock.Unlock()
+	c.collector.ObserveBitrateUpdate(bps)
+}
+
+// setTargetBitrateLocked sets the target bitrate to bps, smoothed if enabled,
+// requests a key frame if the change exceeds keyFrameRateChangeFactor and
+// starts a rate ramp if none is running. c.lock must be held.
+func (c *StatisticalCodec) setTargetBitrateLocked(bps int) {
+	if c.bitrateSmoothing > 0 {
+		bps = int(c.bitrateSmoothing*float64(bps) + (1-c.bitrateSmoothing)*float64(c.targetBitrateBps))
+	}
+	if c.keyFrameRateChangeFactor > 0 && c.targetBitrateBps > 0 {
+		ratio := float64(bps) / float64(c.targetBitrateBps)
+		if ratio > c.keyFrameRateChangeFactor || ratio < 1/c.keyFrameRateChangeFactor {
+			c.keyFrameRequested = true
+		}
+	}
+	if c.effectiveBitrateBps == c.targetBitrateBps {
+		// A ramp starts with the change of the target bitrate, not with
+		// the last frame generated before it.
+		c.lastRampUpdate = c.clock.Now()
+	}
+	c.targetBitrateBps = bps
+}
+
+// emit writes the picture f generated by nextFrame, split into spatial layers
+// if enabled, and the FEC frames protecting it, and passes the media frames
+// which were written successfully to the rate controller.
+func (c *StatisticalCodec) emit(f Frame) {
+	for i, layer := range c.spatialLayerFrames(f) {
+		if i > 0 {
+			layer.SeqNr = c.seqNr
+			c.seqNr++
+		}
+		written := c.writeFrame(layer)
+		if fecFrame, ok := c.fecFrame(layer); ok {
+			c.writeFrame(fecFrame)
+		}
+		if !written {
+			continue
+		}
+		if target, changed := c.rateController.OnFrame(layer); changed {
+			c.updateTargetBitrate(target)
+		}
+	}
+}
+
+// spatialLayerFrames splits the picture f into the frames of the active
+// spatial layers. Only the frame of the top active layer carries the duration
+// of the picture, such that the durations of all frames add up to the
+// duration of the stream.
+func (c *StatisticalCodec) spatialLayerFrames(f Frame) []Frame {
+	if c.spatialLayerShares == nil {
+		return []Frame{f}
+	}
+	active := len(c.spatialLayerShares)
+	for ; active > 1; active-- {
+		if c.minSpatialLayerBitrate(f.TargetBitrate, active) >= float64(c.rMin) {
+			break
+		}
+	}
+	sum := 0.0
+	for _, share := range c.spatialLayerShares[:active] {
+		sum += share
+	}
+	frames := make([]Frame, active)
+	for i, share := range c.spatialLayerShares[:active] {
+		layer := f
+		layer.Content = c.newContent(int(float64(len(f.Content)) * share / sum))
+		layer.SpatialLayerID = i
+		if i < active-1 {
+			layer.Duration = 0
+		}
+		frames[i] = layer
+	}
+	c.ReleaseFrame(f)
+	return frames
+}
+
+// minSpatialLayerBitrate returns the bitrate of the smallest of the lowest n
+// spatial layers if they share bitrateBps.
+func (c *StatisticalCodec) minSpatialLayerBitrate(bitrateBps, n int) float64 {
+	sum := 0.0
+	smallest := c.spatialLayerShares[0]
+	for _, share := range c.spatialLayerShares[:n] {
+		sum += share
+		if share < smallest {
+			smallest = share
+		}
+	}
+	return float64(bitrateBps) * smallest / sum
+}
+
+// writeFrame passes f through the frame hooks and writes it. It reports
+// whether the frame was written successfully.
+func (c *StatisticalCodec) writeFrame(f Frame) bool {
+	for _, hook := range c.frameHooks {
+		hook(&f)
+	}
+	if c.writer != nil {
+		written, err := c.writeWithTimeout(f)
+		if !written {
+			c.lock.Lock()
+			c.stats.WriteTimeouts++
+			c.lock.Unlock()
+			return false
+		}
+		if err != nil {
+			c.handleWriteError(f, err)
+			return false
+		}
+	}
+	if c.frames != nil {
+		if c.flushing {
+			// c.done is already closed while flushing, so selecting on
+			// it would drop the frame.
+			c.frames <- f
+		} else {
+			select {
+			case c.frames <- f:
+			case <-c.done:
+			}
+		}
+	}
+	c.collector.ObserveFrame(len(f.Content), f.Duration)
+
+	c.lock.Lock()
+	c.stats.FramesEmitted++
+	c.stats.BytesEmitted += uint64(len(f.Content))
+	c.stats.RemainingBurstFrames = c.remainingBurstFrames
+	now := c.clock.Now()
+	c.pruneWindowLocked(now)
+	c.window = append(c.window, windowRecord{at: now, size: len(f.Content)})
+	c.lock.Unlock()
+	return true
+}
+
+// pruneWindowLocked removes the frames written before the statistics window
+// preceding now. c.lock must be held.
+func (c *StatisticalCodec) pruneWindowLocked(now time.Time) {
+	i := 0
+	for i < len(c.window) && now.Sub(c.window[i].at) >= c.statsWindow {
+		i++
+	}
+	c.window = c.window[i:]
+}
+
+// writeWithTimeout writes f to the writer. It reports whether the write
+// completed within the write timeout and the error returned by the writer.
+// Errors of abandoned writes which completed in the meantime are handled
+// before f is written.
+func (c *StatisticalCodec) writeWithTimeout(f Frame) (bool, error) {
+	if c.writeTimeout == 0 {
+		return true, c.writer.WriteFrame(f)
+	}
+	if c.writePending {
+		select {
+		case err := <-c.writeResults:
+			c.writePending = false
+			if err != nil {
+				c.handleWriteError(c.pendingFrame, err)
+			}
+		default:
+			return false, nil
+		}
+	}
+	// The worker is idle, so the queue is empty.
+	c.writeQueue <- f
+	timer := c.clock.NewTimer(c.writeTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-c.writeResults:
+		return true, err
+	case <-timer.C():
+		c.writePending = true
+		c.pendingFrame = f
+		return false, nil
+	}
+}
+
+// writeLoop writes the frames queued by writeWithTimeout to the writer until
+// the queue is closed.
+func (c *StatisticalCodec) writeLoop() {
+	for f := range c.writeQueue {
+		c.writeResults <- c.writer.WriteFrame(f)
+	}
+}
+
+// handleWriteError counts the error err returned by the writer for f and
+// applies the error policy.
+func (c *StatisticalCodec) handleWriteError(f Frame, err error) {
+	c.lock.Lock()
+	c.stats.WriteErrors++
+	c.stats.LastWriteError = err
+	c.lock.Unlock()
+
+	switch c.errorPolicy {
+	case ErrorPolicyLog:
+		log.Printf("syncodec: failed to write frame %v: %v", f.SeqNr, err)
+	case ErrorPolicyStop:
+		c.Close()
+	}
+}
+
+// Reset resets the generation state of a stopped codec, such that the next run
+// starts with sequence number 0, PTS 0, no pending transient burst and no
+// carried frame budget. As after every Start, rate updates within tau of the
+// next Start are ignored. Reset returns an error if the codec is running or
+// was closed. Since reaching a limit set by WithMaxFrames or WithMaxDuration
+// closes the codec, only codecs stopped by cancelling the context passed to
+// StartWithContext can be reset.
+func (c *StatisticalCodec) Reset() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	switch c.state {
+	case stateRunning:
+		return errors.New("cannot reset running codec")
+	case stateClosed:
+		return errors.New("cannot reset closed codec")
+	}
+	c.remainingBurstFrames = 0
+	c.remainingDecayFrames = 0
+	c.keyFrameDeferred = false
+	c.lastBurstEnd = time.Time{}
+	c.carryBytes = 0
+	c.fecGroupFrames = 0
+	c.fecGroupBytes = 0
+	c.frameCount = 0
+	c.seqNr = 0
+	c.pts = 0
+	c.stats.RemainingBurstFrames = 0
+	return nil
+}
+
+// Close stops and closes the StatisticalCodec immediately, even if a transient
+// burst is in progress. A closed codec cannot be started again. Close may be
+// called in any state, calling it more than once has no effect.
+func (c *StatisticalCodec) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		if c.state != stateRunning {
+			c.closeFramesLocked()
+		}
+		c.state = stateClosed
+	})
+	return nil
+}
+
+// closeFramesLocked closes the frame channel if it is enabled and not yet
+// closed, and stops the write worker. If the codec is running, the run loop
+// closes the channels when it returns, since it may still send on them.
+// c.lock must be held.
+func (c *StatisticalCodec) closeFramesLocked() {
+	if c.frames != nil && !c.framesClosed {
+		close(c.frames)
+		c.framesClosed = true
+	}
+	if c.writeQueue != nil {
+		close(c.writeQueue)
+		c.writeQueue = nil
+	}
+}
+
+// CloseWithFlush closes the StatisticalCodec like Close, but lets a running
+// codec write the remaining frames of an ongoing transient burst first, such
+// that the stream does not end mid-burst. The frames are written at once
+// instead of at their scheduled time. CloseWithFlush blocks until the run loop
+// returned, so it must not be called from a FrameWriter or frame hook of c. If
+// the codec delivers frames on a channel, CloseWithFlush blocks until the
+// consumer received all flushed frames.
+func (c *StatisticalCodec) CloseWithFlush() error {
+	c.lock.Lock()
+	c.flushOnClose = true
+	running := c.state == stateRunning
+	stopped := c.stopped
+	c.lock.Unlock()
+
+	err := c.Close()
+	if running {
+		<-stopped
+	}
+	return err
 }
@@ -0,0 +1,2073 @@
+package syncodec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// chanWriter is a FrameWriter which sends every frame on a channel.
+type chanWriter chan Frame
+
+func newChanWriter() chanWriter {
+	return make(chanWriter, 1024)
+}
+
+func (w chanWriter) WriteFrame(f Frame) error {
+	w <- f
+	return nil
+}
+
+// newTestEncoder returns a StatisticalCodec writing to a chanWriter, whose run
+// loop is driven by a fake clock.
+func newTestEncoder(t *testing.T, opts ...StatisticalCodecOption) (*StatisticalCodec, chanWriter, *fakeClock) {
+	t.Helper()
+	clock := newFakeClock()
+	w := newChanWriter()
+	c, err := NewStatisticalEncoder(w, append([]StatisticalCodecOption{WithClock(clock), WithRandSeed(1)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, w, clock
+}
+
+// receiveFrame returns the next frame from frames. It fails the test if no
+// frame arrives in time.
+func receiveFrame(t *testing.T, frames <-chan Frame) Frame {
+	t.Helper()
+	select {
+	case f := <-frames:
+		return f
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for frame")
+		return Frame{}
+	}
+}
+
+// expectNoFrame fails the test if a frame is available on frames.
+func expectNoFrame(t *testing.T, frames <-chan Frame) {
+	t.Helper()
+	select {
+	case f := <-frames:
+		t.Fatalf("unexpected frame %v", f.SeqNr)
+	default:
+	}
+}
+
+// startCodec runs c in its own goroutine until the test ends.
+func startCodec(t *testing.T, c *StatisticalCodec) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Start()
+	}()
+	t.Cleanup(func() {
+		c.Close()
+		<-done
+	})
+}
+
+// nextFrames advances clock frame by frame and returns the next n frames
+// written by the running codec c.
+func nextFrames(t *testing.T, clock *fakeClock, w chanWriter, n int) []Frame {
+	t.Helper()
+	frames := make([]Frame, 0, n)
+	for len(frames) < n {
+		select {
+		case f := <-w:
+			frames = append(frames, f)
+			continue
+		default:
+		}
+		clock.Step()
+		frames = append(frames, receiveFrame(t, w))
+	}
+	return frames
+}
+
+func TestStatisticalCodecWithFakeClock(t *testing.T) {
+	c, w, clock := newTestEncoder(t, WithConstantBitrate())
+	start := clock.Now()
+	startCodec(t, c)
+	clock.BlockUntil(1)
+
+	clock.Advance(defaultT0 - time.Nanosecond)
+	expectNoFrame(t, w)
+	clock.Advance(time.Nanosecond)
+	first := receiveFrame(t, w)
+	if got := first.CaptureTime.Sub(start); got != defaultT0 {
+		t.Errorf("first frame generated after %v, want %v", got, defaultT0)
+	}
+
+	interval := time.Second / defaultFPS
+	for i := 1; i <= 10; i++ {
+		clock.Advance(interval)
+		f := receiveFrame(t, w)
+		want := defaultT0 + time.Duration(i)*interval
+		if got := f.CaptureTime.Sub(start); got != want {
+			t.Errorf("frame %v generated after %v, want %v", i, got, want)
+		}
+	}
+}
+
+// waitFor polls cond until it holds. It fails the test if cond does not hold
+// in time.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStatisticalCodecDefaultBitrate(t *testing.T) {
+	c, _, _ := newTestEncoder(t)
+	if got := c.GetTargetBitrate(); got != 1_000_000 {
+		t.Errorf("default target bitrate %v bps, want 1000000", got)
+	}
+	n := 3000
+	total := 0
+	for i := 0; i < n; i++ {
+		f, _ := c.nextFrame()
+		total += len(f.Content)
+	}
+	mean := float64(total) / float64(n)
+	want := 1_000_000.0 / 8 / defaultFPS
+	if math.Abs(mean-want) > 0.02*want {
+		t.Errorf("mean frame size %.0f bytes, want %.0f", mean, want)
+	}
+}
+
+func TestStatisticalCodecSetTargetBitrateConcurrentWithStart(t *testing.T) {
+	c, w, clock := newTestEncoder(t)
+	startCodec(t, c)
+	clock.BlockUntil(1)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			c.SetTargetBitrate(defaultRMin + i*10_000)
+			c.GetTargetBitrate()
+		}
+	}()
+	nextFrames(t, clock, w, 20)
+	<-done
+	if got, want := c.GetTargetBitrate(), defaultRMin+99*10_000; got != want {
+		t.Errorf("target bitrate %v, want %v", got, want)
+	}
+}
+
+func TestStatisticalCodecCloseTwice(t *testing.T) {
+	idle, _, _ := newTestEncoder(t)
+	running, _, clock := newTestEncoder(t)
+	startCodec(t, running)
+	clock.BlockUntil(1)
+
+	for _, c := range []*StatisticalCodec{idle, running} {
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Close(); err != nil {
+			t.Errorf("second Close returned %v", err)
+		}
+	}
+}
+
+func TestStatisticalCodecStartAsync(t *testing.T) {
+	c, w, clock := newTestEncoder(t)
+	if err := c.StartAsync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.StartAsync(); err == nil {
+		t.Error("second StartAsync succeeded")
+	}
+	clock.BlockUntil(1)
+	for i, f := range nextFrames(t, clock, w, 3) {
+		if f.SeqNr != uint64(i) {
+			t.Errorf("frame %v has sequence number %v", i, f.SeqNr)
+		}
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	c.lock.Lock()
+	stopped := c.stopped
+	c.lock.Unlock()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run loop did not return after Close")
+	}
+	clock.Advance(time.Second)
+	expectNoFrame(t, w)
+	if err := c.StartAsync(); err == nil {
+		t.Error("StartAsync of closed codec succeeded")
+	}
+}
+
+func TestStatisticalCodecStartWithContextReturnsOnCancel(t *testing.T) {
+	c, w, clock := newTestEncoder(t)
+	defer c.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.StartWithContext(ctx)
+	}()
+	clock.BlockUntil(1)
+	nextFrames(t, clock, w, 2)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("StartWithContext did not return after cancellation")
+	}
+	clock.Advance(time.Second)
+	expectNoFrame(t, w)
+}
+
+func TestStatisticalCodecRandSeedIsReproducible(t *testing.T) {
+	sequence := func(seed int64) []Frame {
+		c, _, _ := newTestEncoder(t, WithRandSeed(seed))
+		frames := make([]Frame, 100)
+		for i := range frames {
+			frames[i], _ = c.nextFrame()
+		}
+		return frames
+	}
+	a, b, other := sequence(42), sequence(42), sequence(43)
+	differs := false
+	for i := range a {
+		if len(a[i].Content) != len(b[i].Content) || a[i].Duration != b[i].Duration {
+			t.Fatalf("frame %v differs between codecs with equal seeds", i)
+		}
+		if len(a[i].Content) != len(other[i].Content) {
+			differs = true
+		}
+	}
+	if !differs {
+		t.Error("codecs with different seeds generated identical frame sizes")
+	}
+}
+
+func TestStatisticalCodecDefaultSeedsDiffer(t *testing.T) {
+	sequence := func() []int {
+		c, err := NewStatisticalEncoder(newChanWriter())
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes := make([]int, 100)
+		for i := range sizes {
+			f, _ := c.nextFrame()
+			sizes[i] = len(f.Content)
+		}
+		return sizes
+	}
+	a, b := sequence(), sequence()
+	for i := range a {
+		if a[i] != b[i] {
+			return
+		}
+	}
+	t.Error("codecs with default seeds generated identical frame sizes")
+}
+
+func TestStatisticalCodecKeyFrameCadence(t *testing.T) {
+	c, _, _ := newTestEncoder(t, WithGOPSize(10), WithKeyFrameSizeFactor(3), WithSizeNoiseScale(0))
+	bytesPerFrame := defaultTargetBitrateBps / 8 / defaultFPS
+	for i := 0; i < 35; i++ {
+		f, _ := c.nextFrame()
+		if want := i%10 == 0; f.IsKeyFrame != want {
+			t.Errorf("frame %v: key frame %v, want %v", i, f.IsKeyFrame, want)
+		}
+		want := bytesPerFrame
+		if f.IsKeyFrame {
+			want = 3 * bytesPerFrame
+		}
+		if len(f.Content) != want {
+			t.Errorf("frame %v has %v bytes, want %v", i, len(f.Content), want)
+		}
+	}
+}
+
+func TestStatisticalCodecBurstSpendsSteadyStateBudget(t *testing.T) {
+	for _, fps := range []int{30, 60} {
+		c, _, _ := newTestEncoder(t, WithFramesPerSecond(fps), WithSizeNoiseScale(0))
+		c.updateTargetBitrate(defaultTargetBitrateBps)
+		bytesPerFrame := defaultTargetBitrateBps / 8 / fps
+		total := 0
+		for i := 0; i < defaultBurstFrameCount; i++ {
+			f, _ := c.nextFrame()
+			if i == 0 && len(f.Content) != defaultBurstFrameSize {
+				t.Errorf("first burst frame at %v fps has %v bytes, want %v", fps, len(f.Content), defaultBurstFrameSize)
+			}
+			total += len(f.Content)
+		}
+		want := defaultBurstFrameCount * bytesPerFrame
+		if total > want || total < want-defaultBurstFrameCount {
+			t.Errorf("burst at %v fps spends %v bytes, want %v", fps, total, want)
+		}
+	}
+}
+
+func TestStatisticalCodecNominalDurationAt60FPS(t *testing.T) {
+	c, _, _ := newTestEncoder(t, WithFramesPerSecond(60), WithDurationNoiseScale(0))
+	f, _ := c.nextFrame()
+	want := 16_666_667 * time.Nanosecond
+	if d := f.Duration - want; d > time.Microsecond || d < -time.Microsecond {
+		t.Errorf("frame duration %v, want %v", f.Duration, want)
+	}
+}
+
+func TestStatisticalCodecSequenceNumbersAreContiguous(t *testing.T) {
+	c, w, clock := newTestEncoder(t, WithGOPSize(5), WithReactionLatency(0))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.StartWithContext(ctx)
+	}()
+	clock.BlockUntil(1)
+
+	frames := nextFrames(t, clock, w, 3)
+	c.RequestTargetBitrate(500_000)
+	waitFor(t, func() bool { return c.Stats().RemainingBurstFrames > 0 })
+	frames = append(frames, nextFrames(t, clock, w, 3)...)
+	c.TriggerKeyFrame()
+	frames = append(frames, nextFrames(t, clock, w, 10)...)
+	keyFrames := 0
+	for i, f := range frames {
+		if f.SeqNr != uint64(i) {
+			t.Errorf("frame %v has sequence number %v", i, f.SeqNr)
+		}
+		if f.IsKeyFrame {
+			keyFrames++
+		}
+	}
+	if keyFrames < 2 {
+		t.Errorf("%v key frames, want periodic and triggered key frames", keyFrames)
+	}
+
+	cancel()
+	<-done
+	startCodec(t, c)
+	clock.BlockUntil(1)
+	if f := nextFrames(t, clock, w, 1)[0]; f.SeqNr != 0 {
+		t.Errorf("first frame after restart has sequence number %v", f.SeqNr)
+	}
+}
+
+func TestStatisticalCodecFrameHooks(t *testing.T) {
+	var mu sync.Mutex
+	calls := []string{}
+	record := func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, name)
+	}
+	c, w, clock := newTestEncoder(t,
+		WithFrameHook(func(f *Frame) {
+			record("first")
+			f.Content = f.Content[:10]
+			f.IsKeyFrame = true
+		}),
+		WithFrameHook(func(f *Frame) {
+			record("second")
+			if len(f.Content) != 10 {
+				t.Errorf("second hook saw %v bytes, want the 10 bytes left by the first hook", len(f.Content))
+			}
+			f.Content = append(f.Content, 0xff)
+		}),
+	)
+	startCodec(t, c)
+	clock.BlockUntil(1)
+
+	for i, f := range nextFrames(t, clock, w, 3) {
+		if len(f.Content) != 11 || f.Content[10] != 0xff || !f.IsKeyFrame {
+			t.Errorf("frame %v written with %v bytes and key frame %v, want the frame modified by both hooks", i, len(f.Content), f.IsKeyFrame)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for i := 0; i < 3; i++ {
+		if calls[2*i] != "first" || calls[2*i+1] != "second" {
+			t.Fatalf("hooks called in order %v, want first before second", calls)
+		}
+	}
+}
+
+func TestStatisticalCodecConstantBitrate(t *testing.T) {
+	c, _, _ := newTestEncoder(t, WithConstantBitrate())
+	c.updateTargetBitrate(defaultTargetBitrateBps)
+	first, _ := c.nextFrame()
+	if len(first.Content) != defaultTargetBitrateBps/8/defaultFPS {
+		t.Errorf("frame has %v bytes, want %v", len(first.Content), defaultTargetBitrateBps/8/defaultFPS)
+	}
+	for i := 1; i < 50; i++ {
+		f, _ := c.nextFrame()
+		if len(f.Content) != len(first.Content) || f.Duration != first.Duration {
+			t.Fatalf("frame %v has %v bytes and duration %v, want %v bytes and duration %v", i, len(f.Content), f.Duration, len(first.Content), first.Duration)
+		}
+	}
+}
+
+func TestStatisticalCodecSetFPS(t *testing.T) {
+	c, w, clock := newTestEncoder(t, WithDurationNoiseScale(0))
+	startCodec(t, c)
+	clock.BlockUntil(1)
+	before := nextFrames(t, clock, w, 2)
+	if want := time.Second / defaultFPS; before[1].Duration != want {
+		t.Errorf("frame duration %v at %v fps, want %v", before[1].Duration, defaultFPS, want)
+	}
+
+	if err := c.SetFPS(10); err != nil {
+		t.Fatal(err)
+	}
+	after := nextFrames(t, clock, w, 3)
+	for i, f := range after {
+		if f.Duration != 100*time.Millisecond {
+			t.Errorf("frame %v has duration %v at 10 fps, want 100ms", i, f.Duration)
+		}
+		if i > 0 {
+			if d := f.CaptureTime.Sub(after[i-1].CaptureTime); d != 100*time.Millisecond {
+				t.Errorf("frame %v generated %v after its predecessor, want 100ms", i, d)
+			}
+		}
+	}
+	if err := c.SetFPS(0); err == nil {
+		t.Error("frame rate 0 accepted")
+	}
+}
+
+func TestStatisticalCodecGetFPS(t *testing.T) {
+	c, _, _ := newTestEncoder(t, WithFramesPerSecond(25))
+	if got := c.GetFPS(); got != 25 {
+		t.Errorf("GetFPS() = %v, want 25", got)
+	}
+	if err := c.SetFPS(60); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.GetFPS(); got != 60 {
+		t.Errorf("GetFPS() = %v after SetFPS(60)", got)
+	}
+	if p := NewPerfectCodec(newChanWriter(), 1_000_000); p.GetFPS() != 30 {
+		t.Errorf("PerfectCodec.GetFPS() = %v, want 30", p.GetFPS())
+	}
+}
+
+func TestStatisticalCodecTriggerKeyFrame(t *testing.T) {
+	c, _, _ := newTestEncoder(t, WithSizeNoiseScale(0))
+	bytesPerFrame := defaultTargetBitrateBps / 8 / defaultFPS
+	if f, _ := c.nextFrame(); f.IsKeyFrame {
+		t.Error("key frame without GOP or trigger")
+	}
+	c.TriggerKeyFrame()
+	f, _ := c.nextFrame()
+	if !f.IsKeyFrame {
+		t.Fatal("triggered frame is no key frame")
+	}
+	if want := int(defaultKeyFrameSizeFactor * float64(bytesPerFrame)); len(f.Content) != want {
+		t.Errorf("key frame has %v bytes, want %v", len(f.Content), want)
+	}
+	if f, _ := c.nextFrame(); f.IsKeyFrame {
+		t.Error("frame after triggered key frame is a key frame")
+	}
+}
+
+func TestStatisticalCodecFrameTargetBitrate(t *testing.T) {
+	c, _, _ := newTestEncoder(t)
+	if f, _ := c.nextFrame(); f.TargetBitrate != defaultTargetBitrateBps {
+		t.Errorf("frame reports %v bps, want %v", f.TargetBitrate, defaultTargetBitrateBps)
+	}
+	c.updateTargetBitrate(500_000)
+	for i := 0; i < defaultBurstFrameCount+1; i++ {
+		if f, _ := c.nextFrame(); f.TargetBitrate != 500_000 {
+			t.Errorf("frame %v after update reports %v bps, want 500000", i, f.TargetBitrate)
+		}
+	}
+}
+
+func TestStatisticalCodecPauseResume(t *testing.T) {
+	c, w, clock := newTestEncoder(t)
+	startCodec(t, c)
+	clock.BlockUntil(1)
+	nextFrames(t, clock, w, 2)
+
+	c.Pause()
+	for i := 0; i < 5; i++ {
+		clock.BlockUntil(1)
+		clock.Step()
+	}
+	clock.BlockUntil(1)
+	expectNoFrame(t, w)
+
+	c.Resume()
+	clock.Step()
+	if f := receiveFrame(t, w); f.SeqNr != 2 {
+		t.Errorf("first frame after resume has sequence number %v, want 2", f.SeqNr)
+	}
+}
+
+func TestStatisticalCodecTemporalLayerPattern(t *testing.T) {
+	for layers, want := range map[int][]int{
+		1: {0, 0, 0, 0, 0, 0, 0, 0},
+		2: {0, 1, 0, 1, 0, 1, 0, 1},
+		3: {0, 2, 1, 2, 0, 2, 1, 2},
+	} {
+		c, _, _ := newTestEncoder(t, WithTemporalLayers(layers))
+		got := make([]int, len(want))
+		for i := range got {
+			f, _ := c.nextFrame()
+			got[i] = f.TemporalLayerID
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%v layers: pattern %v, want %v", layers, got, want)
+		}
+	}
+}
+
+func TestStatisticalCodecRateRampConvergesLinearly(t *testing.T) {
+	c, _, clock := newTestEncoder(t, WithInitialTargetBitrate(400_000), WithRateRamp(50_000, 50*time.Millisecond))
+	c.updateTargetBitrate(1_000_000)
+	if c.remainingBurstFrames != defaultBurstFrameCount {
+		t.Errorf("%v burst frames pending at ramp start, want %v", c.remainingBurstFrames, defaultBurstFrameCount)
+	}
+	for k := 1; k <= 15; k++ {
+		clock.Advance(50 * time.Millisecond)
+		f, _ := c.nextFrame()
+		want := min(400_000+k*50_000, 1_000_000)
+		if f.TargetBitrate != want {
+			t.Errorf("step %v: effective bitrate %v, want %v", k, f.TargetBitrate, want)
+		}
+	}
+}
+
+func TestStatisticalCodecContentFill(t *testing.T) {
+	frame := func(fill ContentFill) []byte {
+		c, _, _ := newTestEncoder(t, WithContentFill(fill))
+		f, _ := c.nextFrame()
+		return f.Content
+	}
+
+	for i, b := range frame(ContentFillZero) {
+		if b != 0 {
+			t.Fatalf("zero filled content has byte %v at %v", b, i)
+		}
+	}
+	for i, b := range frame(ContentFillIncrementing) {
+		if b != byte(i) {
+			t.Fatalf("incrementing content has byte %v at %v", b, i)
+		}
+	}
+	random := frame(ContentFillRandom)
+	if bytes.Count(random, []byte{0}) > len(random)/100 {
+		t.Error("random content mostly zero")
+	}
+	if !bytes.Equal(random, frame(ContentFillRandom)) {
+		t.Error("random content differs between codecs with equal seeds")
+	}
+}
+
+func benchmarkSteadyState(b *testing.B, opts ...StatisticalCodecOption) {
+	c, err := NewStatisticalEncoder(newChanWriter(), append([]StatisticalCodecOption{WithClock(newFakeClock()), WithRandSeed(1)}, opts...)...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		f, _ := c.nextFrame()
+		c.ReleaseFrame(f)
+	}
+}
+
+func BenchmarkStatisticalCodecSteadyState(b *testing.B) {
+	benchmarkSteadyState(b)
+}
+
+func BenchmarkStatisticalCodecSteadyStateBufferPool(b *testing.B) {
+	benchmarkSteadyState(b, WithBufferPool())
+}
+
+func TestStatisticalCodecMinFrameSizeDropsFramesAtLowBitrate(t *testing.T) {
+	const bitrate = 12_000
+	c, _, _ := newTestEncoder(t,
+		WithRateBounds(8_000, defaultRMax),
+		WithInitialTargetBitrate(bitrate),
+		WithMinFrameSize(200),
+	)
+	n := 30 * defaultFPS
+	total, emitted := 0, 0
+	for i := 0; i < n; i++ {
+		f, ok := c.nextFrame()
+		if !ok {
+			continue
+		}
+		if !f.IsKeyFrame && len(f.Content) < 200 {
+			t.Errorf("frame %v has %v bytes, below the minimum frame size", f.SeqNr, len(f.Content))
+		}
+		total += len(f.Content)
+		emitted++
+	}
+	if emitted > n/2 {
+		t.Errorf("%v of %v frames emitted, want frames to be dropped", emitted, n)
+	}
+	got := float64(total*8) / (float64(n) / defaultFPS)
+	if math.Abs(got-bitrate) > 0.05*bitrate {
+		t.Errorf("average bitrate %.0f bps, want %v", got, bitrate)
+	}
+}
+
+// sequenceNoiser is a Noiser which repeats a fixed sequence of samples.
+type sequenceNoiser struct {
+	samples []float64
+	next    int
+}
+
+func (n *sequenceNoiser) Noise() float64 {
+	s := n.samples[n.next%len(n.samples)]
+	n.next++
+	return s
+}
+
+func TestStatisticalCodecScheduleJitterPerturbsTimerInterval(t *testing.T) {
+	samples := []float64{0.1, -0.2, 0, 0.3}
+	c, w, clock := newTestEncoder(t, WithScheduleJitter(&sequenceNoiser{samples: samples}))
+	startCodec(t, c)
+	clock.BlockUntil(1)
+
+	frames := nextFrames(t, clock, w, 9)
+	nominal := time.Second / defaultFPS
+	for i, f := range frames {
+		if f.Duration != nominal {
+			t.Errorf("frame %v has duration %v, want %v", i, f.Duration, nominal)
+		}
+		if i == 0 {
+			continue
+		}
+		want := time.Duration(float64(nominal) * (1 - samples[(i-1)%len(samples)]))
+		if got := f.CaptureTime.Sub(frames[i-1].CaptureTime); got != want {
+			t.Errorf("interval before frame %v is %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestStatisticalCodecFECCadenceAndOverhead(t *testing.T) {
+	const groupSize, overhead = 4, 0.25
+	c, w, clock := newTestEncoder(t, WithFEC(groupSize, overhead))
+	startCodec(t, c)
+	clock.BlockUntil(1)
+
+	frames := nextFrames(t, clock, w, 10*(groupSize+1))
+	mediaBytes, fecBytes, group := 0, 0, 0
+	for i, f := range frames {
+		if f.SeqNr != uint64(i) {
+			t.Errorf("frame %v has sequence number %v", i, f.SeqNr)
+		}
+		if !f.IsFEC {
+			mediaBytes += len(f.Content)
+			group += len(f.Content)
+			continue
+		}
+		if i%(groupSize+1) != groupSize {
+			t.Errorf("FEC frame at position %v, want one after every %v media frames", i, groupSize)
+		}
+		if f.Duration != 0 {
+			t.Errorf("FEC frame %v has duration %v, want 0", i, f.Duration)
+		}
+		if want := int(float64(group) * overhead); len(f.Content) != want {
+			t.Errorf("FEC frame %v has %v bytes, want %v", i, len(f.Content), want)
+		}
+		fecBytes += len(f.Content)
+		group = 0
+	}
+	if got := float64(fecBytes) / float64(mediaBytes); math.Abs(got-overhead) > 0.01 {
+		t.Errorf("FEC overhead %.3f, want %v", got, overhead)
+	}
+}
+
+func TestStatisticalCodecStrictBoundsReportsClampedSizes(t *testing.T) {
+	c, _, _ := newTestEncoder(t, WithStrictBounds(), WithFramesPerSecond(1000), WithInitialTargetBitrate(defaultRMin))
+	c.updateTargetBitrate(defaultRMin)
+	for i := 0; i < 100; i++ {
+		c.nextFrame()
+	}
+
+	quantities := map[string]bool{}
+	for drained := false; !drained; {
+		select {
+		case err := <-c.Errors():
+			var boundsErr *BoundsError
+			if !errors.As(err, &boundsErr) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			quantities[boundsErr.Quantity] = true
+		default:
+			drained = true
+		}
+	}
+	for _, quantity := range []string{"burst frame size", "frame size"} {
+		if !quantities[quantity] {
+			t.Errorf("no clamped %v reported", quantity)
+		}
+	}
+
+	lenient, _, _ := newTestEncoder(t)
+	if lenient.Errors() != nil {
+		t.Error("error channel enabled without strict mode")
+	}
+}
+
+func TestStatisticalCodecStatsAdvanceWithFrames(t *testing.T) {
+	c, w, clock := newTestEncoder(t)
+	start := clock.Now()
+	if stats := c.Stats(); stats.FramesEmitted != 0 || stats.BytesEmitted != 0 || stats.SinceLastBitrateUpdate != 0 {
+		t.Errorf("unexpected stats before start: %+v", stats)
+	}
+	startCodec(t, c)
+	clock.BlockUntil(1)
+
+	bytes := uint64(0)
+	for _, f := range nextFrames(t, clock, w, 5) {
+		bytes += uint64(len(f.Content))
+	}
+	waitFor(t, func() bool { return c.Stats().FramesEmitted == 5 })
+	stats := c.Stats()
+	if stats.BytesEmitted != bytes {
+		t.Errorf("%v bytes emitted, want %v", stats.BytesEmitted, bytes)
+	}
+	if stats.TargetBitrate != defaultTargetBitrateBps {
+		t.Errorf("target bitrate %v, want %v", stats.TargetBitrate, defaultTargetBitrateBps)
+	}
+	if want := clock.Now().Sub(start); stats.SinceLastBitrateUpdate != want {
+		t.Errorf("%v since last bitrate update, want %v", stats.SinceLastBitrateUpdate, want)
+	}
+
+	c.SetTargetBitrate(2 * defaultRMin)
+	if stats := c.Stats(); stats.TargetBitrate != 2*defaultRMin || stats.SinceLastBitrateUpdate != 0 {
+		t.Errorf("unexpected stats after bitrate update: %+v", stats)
+	}
+	clock.Advance(time.Millisecond)
+	if got := c.Stats().SinceLastBitrateUpdate; got != time.Millisecond {
+		t.Errorf("%v since last bitrate update, want 1ms", got)
+	}
+}
+
+func TestStatisticalCodecInitialTimerInterval(t *testing.T) {
+	t0 := 250 * time.Millisecond
+	c, w, clock := newTestEncoder(t, WithInitialTimerInterval(t0))
+	start := clock.Now()
+	startCodec(t, c)
+	clock.BlockUntil(1)
+
+	clock.Advance(t0 - time.Nanosecond)
+	expectNoFrame(t, w)
+	clock.Advance(time.Nanosecond)
+	if f := receiveFrame(t, w); f.CaptureTime.Sub(start) != t0 {
+		t.Errorf("first frame generated after %v, want %v", f.CaptureTime.Sub(start), t0)
+	}
+}
+
+func TestStatisticalCodecReferenceFrameSize(t *testing.T) {
+	c, _, _ := newTestEncoder(t, WithQuantizer(referenceQP), WithReferenceFrameSize(2000), WithSizeNoiseScale(0))
+	for i := 0; i < 3; i++ {
+		if f, _ := c.nextFrame(); len(f.Content) != 2000 {
+			t.Errorf("frame %v has %v bytes at the reference quantizer, want 2000", i, len(f.Content))
+		}
+	}
+	if err := c.SetQuantizer(2 * referenceQP); err != nil {
+		t.Fatal(err)
+	}
+	if f, _ := c.nextFrame(); len(f.Content) != 1000 {
+		t.Errorf("frame has %v bytes at twice the reference quantizer, want 1000", len(f.Content))
+	}
+}
+
+func TestStatisticalCodecRejectsNonPositiveReferenceValues(t *testing.T) {
+	for name, opt := range map[string]StatisticalCodecOption{
+		"t0": WithInitialTimerInterval(0),
+		"b0": WithReferenceFrameSize(0),
+	} {
+		if _, err := NewStatisticalEncoder(newChanWriter(), opt); err == nil {
+			t.Errorf("non-positive %v accepted", name)
+		}
+	}
+}
+
+func TestStatisticalCodecRejectsInvalidFPS(t *testing.T) {
+	for _, fps := range []int{0, -30, maxFPS + 1} {
+		if _, err := NewStatisticalEncoder(newChanWriter(), WithFramesPerSecond(fps)); err == nil {
+			t.Errorf("expected construction error for %v fps", fps)
+		}
+	}
+	for _, fps := range []int{1, maxFPS} {
+		if _, err := NewStatisticalEncoder(newChanWriter(), WithFramesPerSecond(fps)); err != nil {
+			t.Errorf("unexpected error for %v fps: %v", fps, err)
+		}
+	}
+}
+
+func TestStatisticalCodecResetRestartsGeneration(t *testing.T) {
+	for _, reset := range []bool{false, true} {
+		c, w, clock := newTestEncoder(t, WithReactionLatency(0))
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			c.StartWithContext(ctx)
+		}()
+		clock.BlockUntil(1)
+		nextFrames(t, clock, w, 2)
+		c.RequestTargetBitrate(defaultRMin)
+		waitFor(t, func() bool { return c.CurrentPhase() == PhaseBurst })
+		nextFrames(t, clock, w, 2)
+		cancel()
+		<-done
+		for len(w) > 0 {
+			<-w
+		}
+
+		if reset {
+			if err := c.Reset(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		startCodec(t, c)
+		clock.BlockUntil(1)
+		f := nextFrames(t, clock, w, 1)[0]
+		if f.SeqNr != 0 || f.PTS != 0 {
+			t.Errorf("first frame of second run has sequence number %v and PTS %v, want 0", f.SeqNr, f.PTS)
+		}
+		if got := c.CurrentPhase() == PhaseBurst; got != !reset {
+			t.Errorf("reset %v: second run continues burst %v, want %v", reset, got, !reset)
+		}
+	}
+}
+
+func TestStatisticalCodecResetFailsUnlessStopped(t *testing.T) {
+	c, _, clock := newTestEncoder(t)
+	if err := c.StartAsync(); err != nil {
+		t.Fatal(err)
+	}
+	clock.BlockUntil(1)
+	if err := c.Reset(); err == nil {
+		t.Error("expected error resetting running codec")
+	}
+	c.Close()
+	if err := c.Reset(); err == nil {
+		t.Error("expected error resetting closed codec")
+	}
+
+	c, w, clock := newTestEncoder(t, WithMaxFrames(1))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Start()
+	}()
+	clock.BlockUntil(1)
+	nextFrames(t, clock, w, 1)
+	<-done
+	if err := c.Reset(); err == nil {
+		t.Error("expected error resetting codec stopped by a limit")
+	}
+}
+
+func TestStatisticalCodecScheduleBitrate(t *testing.T) {
+	// Without duration noise, no frame is due at the time of an event.
+	c, _, clock := newTestEncoder(t, WithDurationNoiseScale(0))
+	c.ScheduleBitrate([]BitrateEvent{
+		{Offset: 600 * time.Millisecond, TargetBitrate: 600_000},
+		{Offset: 300 * time.Millisecond, TargetBitrate: 300_000},
+		{Offset: 700 * time.Millisecond, TargetBitrate: 900_000},
+		{Offset: time.Second, TargetBitrate: 1_000_000},
+	})
+	start := clock.Now()
+	startCodec(t, c)
+	clock.BlockUntil(2)
+
+	steps := []struct {
+		offset time.Duration
+		before int
+		after  int
+	}{
+		{300 * time.Millisecond, defaultTargetBitrateBps, 300_000},
+		{600 * time.Millisecond, 300_000, 600_000},
+		// The update at 700ms is within tau of the previous one.
+		{700 * time.Millisecond, 600_000, 600_000},
+		{time.Second, 600_000, 1_000_000},
+	}
+	for i, step := range steps {
+		clock.Advance(step.offset - clock.Now().Sub(start) - time.Nanosecond)
+		if got := c.GetTargetBitrate(); got != step.before {
+			t.Errorf("target bitrate %v before %v, want %v", got, step.offset, step.before)
+		}
+		clock.Advance(time.Nanosecond)
+		want := step.after
+		waitFor(t, func() bool { return c.GetTargetBitrate() == want })
+		if step.after != step.before && c.Stats().RemainingBurstFrames != defaultBurstFrameCount {
+			t.Errorf("no transient burst after scheduled update at %v", step.offset)
+		}
+		if i < len(steps)-1 {
+			// Wait until the run loop armed the timer of the next event.
+			clock.BlockUntil(2)
+		}
+	}
+}
+
+func TestStatisticalCodecMaxFrameSizePreservesAverageBitrate(t *testing.T) {
+	const bitrate, maxFrameSize = 1_000_000, 4500
+	c, _, _ := newTestEncoder(t,
+		WithInitialTargetBitrate(bitrate),
+		WithSizeNoiseScale(0.5),
+		WithMaxFrameSize(maxFrameSize),
+	)
+	n := 60 * defaultFPS
+	total, steady, capped := 0, 0, 0
+	for i := 0; i < n; i++ {
+		f, _ := c.nextFrame()
+		if f.IsKeyFrame {
+			continue
+		}
+		if len(f.Content) > maxFrameSize {
+			t.Fatalf("frame %v has %v bytes, above the maximum frame size", f.SeqNr, len(f.Content))
+		}
+		if len(f.Content) == maxFrameSize {
+			capped++
+		}
+		total += len(f.Content)
+		steady++
+	}
+	if capped < steady/10 {
+		t.Errorf("only %v of %v frames capped, want a tight cap", capped, steady)
+	}
+	got := float64(total*8) / (float64(steady) / defaultFPS)
+	if math.Abs(got-bitrate) > 0.02*bitrate {
+		t.Errorf("average bitrate %.0f bps, want %v", got, bitrate)
+	}
+}
+
+func TestStatisticalCodecSizeNoiseScaleControlsVariance(t *testing.T) {
+	variance := func(scale float64) float64 {
+		c, _, _ := newTestEncoder(t, WithSizeNoiseScale(scale), WithGOPSize(1<<20))
+		sizes := make([]float64, 0, 1000)
+		for i := 0; i < 1000; i++ {
+			f, _ := c.nextFrame()
+			if !f.IsKeyFrame {
+				sizes = append(sizes, float64(len(f.Content)))
+			}
+		}
+		mean := 0.0
+		for _, s := range sizes {
+			mean += s
+		}
+		mean /= float64(len(sizes))
+		v := 0.0
+		for _, s := range sizes {
+			v += (s - mean) * (s - mean)
+		}
+		return v / float64(len(sizes))
+	}
+	if v := variance(0); v != 0 {
+		t.Errorf("frame size variance %v without noise, want 0", v)
+	}
+	small, large := variance(0.05), variance(0.2)
+	if large <= 4*small {
+		t.Errorf("frame size variance %.0f at scale 0.2 not larger than %.0f at scale 0.05", large, small)
+	}
+
+	for _, opt := range []StatisticalCodecOption{WithSizeNoiseScale(-0.1), WithDurationNoiseScale(-0.1)} {
+		if _, err := NewStatisticalEncoder(newChanWriter(), opt); err == nil {
+			t.Error("expected error for negative noise scale")
+		}
+	}
+}
+
+func TestStatisticalCodecFrameSizesBeyond32BitProducts(t *testing.T) {
+	if got, want := steadyStateFrameBytes(math.MaxInt32, 1), math.MaxInt32/8; got != want {
+		t.Errorf("steady state frame size %v at MaxInt32 bps, want %v", got, want)
+	}
+	// The budget of the burst, burstFrameCount times the steady state frame
+	// size, exceeds the range of a 32-bit int.
+	bytesPerFrame := math.MaxInt32 / 4
+	for _, shape := range []TransientShape{TransientSquare, TransientExponential, TransientLinear} {
+		c, _, _ := newTestEncoder(t, WithTransientShape(shape))
+		total := 0.0
+		for k := 0; k < c.burstFrameCount; k++ {
+			size := c.transientFrameSize(k, bytesPerFrame)
+			if size <= 0 || size > 2*bytesPerFrame {
+				t.Errorf("shape %v: burst frame %v has %v bytes", shape, k, size)
+			}
+			total += float64(size)
+		}
+		want := float64(c.burstFrameCount) * float64(bytesPerFrame)
+		if math.Abs(total-want) > float64(c.burstFrameCount) {
+			t.Errorf("shape %v: burst spends %.0f bytes, want %.0f", shape, total, want)
+		}
+	}
+}
+
+func TestStatisticalCodecKeyFrameOnRateChange(t *testing.T) {
+	c, _, _ := newTestEncoder(t, WithInitialTargetBitrate(300_000), WithKeyFrameOnRateChange(2), WithGOPSize(1<<20))
+	c.nextFrame()
+	for _, step := range []struct {
+		bitrate  int
+		keyFrame bool
+	}{
+		{900_000, true},
+		{990_000, false},
+		{330_000, true},
+		{300_000, false},
+	} {
+		c.SetTargetBitrate(step.bitrate)
+		if f, _ := c.nextFrame(); f.IsKeyFrame != step.keyFrame {
+			t.Errorf("key frame %v after change to %v bps, want %v", f.IsKeyFrame, step.bitrate, step.keyFrame)
+		}
+		if f, _ := c.nextFrame(); f.IsKeyFrame {
+			t.Errorf("second frame after change to %v bps is a key frame", step.bitrate)
+		}
+	}
+}
+
+func TestStatisticalCodecStartsWithKeyFrame(t *testing.T) {
+	c, w, clock := newTestEncoder(t, WithGOPSize(100))
+	defer c.Close()
+	for run := 0; run < 2; run++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			c.StartWithContext(ctx)
+		}()
+		clock.BlockUntil(1)
+		frames := nextFrames(t, clock, w, 3)
+		cancel()
+		<-done
+		for i, f := range frames {
+			if want := i == 0; f.IsKeyFrame != want {
+				t.Errorf("run %v, frame %v: key frame %v, want %v", run, i, f.IsKeyFrame, want)
+			}
+		}
+	}
+
+	plain, w, clock := newTestEncoder(t)
+	startCodec(t, plain)
+	clock.BlockUntil(1)
+	if f := nextFrames(t, clock, w, 1)[0]; f.IsKeyFrame {
+		t.Error("first frame is a key frame without GOP")
+	}
+}
+
+func TestStatisticalCodecRejectsNilWriter(t *testing.T) {
+	if _, err := NewStatisticalEncoder(nil); err == nil {
+		t.Error("expected error for nil writer")
+	}
+	if _, err := NewStatisticalEncoder(newChanWriter(), WithWriter(nil)); err == nil {
+		t.Error("expected error for nil writer option")
+	}
+	if _, err := NewStatisticalEncoder(nil, WithFrameChannel(1)); err != nil {
+		t.Errorf("unexpected error for nil writer with frame channel: %v", err)
+	}
+
+	clock := newFakeClock()
+	w := newChanWriter()
+	c, err := NewStatisticalEncoder(nil, WithWriter(w), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	startCodec(t, c)
+	clock.BlockUntil(1)
+	nextFrames(t, clock, w, 1)
+}
+
+func TestStatisticalCodecMaxFrames(t *testing.T) {
+	finished := make(chan struct{})
+	c, w, clock := newTestEncoder(t, WithMaxFrames(5), WithOnFinish(func() { close(finished) }))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Start()
+	}()
+	clock.BlockUntil(1)
+
+	nextFrames(t, clock, w, 5)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start did not return after max frames")
+	}
+	select {
+	case <-finished:
+	default:
+		t.Error("finish callback not called")
+	}
+	clock.Advance(time.Second)
+	expectNoFrame(t, w)
+}
+
+func TestStatisticalCodecMaxDurationWinsOverMaxFrames(t *testing.T) {
+	const maxDuration = 200 * time.Millisecond
+	c, w, clock := newTestEncoder(t, WithMaxFrames(100), WithMaxDuration(maxDuration), WithDurationNoiseScale(0))
+	start := clock.Now()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Start()
+	}()
+	clock.BlockUntil(2)
+
+	for clock.Now().Sub(start) < maxDuration {
+		clock.Step()
+		if clock.Now().Sub(start) < maxDuration {
+			// Wait until the run loop rearmed the frame timer.
+			clock.BlockUntil(2)
+		}
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start did not return after max duration")
+	}
+	close(w)
+	n := 0
+	for range w {
+		n++
+	}
+	// Frames are due at t0 and every 1/fps thereafter.
+	if want := 1 + int((maxDuration-defaultT0)/(time.Second/defaultFPS)); n != want {
+		t.Errorf("%v frames written within max duration, want %v", n, want)
+	}
+}
+
+func TestStatisticalCodecBitrateSmoothingDampensOscillation(t *testing.T) {
+	variance := func(alpha float64) float64 {
+		c, _, _ := newTestEncoder(t, WithBitrateSmoothing(alpha), WithSizeNoiseScale(0))
+		bitrates := []float64{}
+		for i := 0; i < 200; i++ {
+			target := 300_000
+			if i%2 == 1 {
+				target = 1_200_000
+			}
+			c.SetTargetBitrate(target)
+			f, _ := c.nextFrame()
+			if i >= 20 {
+				bitrates = append(bitrates, float64(len(f.Content)*8*defaultFPS))
+			}
+		}
+		mean := 0.0
+		for _, b := range bitrates {
+			mean += b
+		}
+		mean /= float64(len(bitrates))
+		v := 0.0
+		for _, b := range bitrates {
+			v += (b - mean) * (b - mean)
+		}
+		return v / float64(len(bitrates))
+	}
+	raw, smoothed := variance(1), variance(0.2)
+	if smoothed > raw/4 {
+		t.Errorf("emitted bitrate variance %.3g with smoothing, want well below %.3g without", smoothed, raw)
+	}
+}
+
+func TestStatisticalCodecCloseWithFlushWritesRemainingBurst(t *testing.T) {
+	clock := newFakeClock()
+	c, err := NewStatisticalEncoder(nil, WithClock(clock), WithRandSeed(1), WithReactionLatency(0), WithFrameChannel(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Start()
+	}()
+	clock.BlockUntil(1)
+	c.RequestTargetBitrate(1_000_000)
+	waitFor(t, func() bool { return c.Stats().RemainingBurstFrames == defaultBurstFrameCount })
+	clock.Step()
+	<-c.Frames()
+
+	flushed := make(chan error, 1)
+	go func() {
+		flushed <- c.CloseWithFlush()
+	}()
+	n := 0
+	for range c.Frames() {
+		n++
+	}
+	if want := defaultBurstFrameCount - 1; n != want {
+		t.Errorf("flushed %v frames, want %v", n, want)
+	}
+	if err := <-flushed; err != nil {
+		t.Fatal(err)
+	}
+	<-done
+}
+
+func TestStatisticalCodecEffectiveBitrateFollowsRamp(t *testing.T) {
+	c, _, clock := newTestEncoder(t, WithInitialTargetBitrate(500_000), WithRateRamp(100_000, 100*time.Millisecond))
+	c.SetTargetBitrate(1_000_000)
+	for i := 1; i < 5; i++ {
+		clock.Advance(100 * time.Millisecond)
+		c.nextFrame()
+		if got, want := c.GetEffectiveBitrate(), 500_000+i*100_000; got != want {
+			t.Errorf("effective bitrate %v after %v steps, want %v", got, i, want)
+		}
+		if got := c.GetTargetBitrate(); got != 1_000_000 {
+			t.Errorf("target bitrate %v during ramp, want 1000000", got)
+		}
+	}
+	clock.Advance(100 * time.Millisecond)
+	c.nextFrame()
+	if got := c.GetEffectiveBitrate(); got != 1_000_000 {
+		t.Errorf("effective bitrate %v after ramp, want 1000000", got)
+	}
+
+	// The target is reported as requested, the effective bitrate is clamped.
+	c.SetTargetBitrate(5_000_000)
+	clock.Advance(time.Second)
+	c.nextFrame()
+	if got := c.GetTargetBitrate(); got != 5_000_000 {
+		t.Errorf("target bitrate %v, want 5000000", got)
+	}
+	if got := c.GetEffectiveBitrate(); got != defaultRMax {
+		t.Errorf("effective bitrate %v, want %v", got, defaultRMax)
+	}
+}
+
+func TestStatisticalCodecSoftFloorPreservesMeanFrameSize(t *testing.T) {
+	const bitrate = 300_000
+	c, _, _ := newTestEncoder(t, WithInitialTargetBitrate(bitrate), WithSizeNoiseScale(1.5))
+	b0 := float64(bitrate) / 8 / defaultFPS
+	n := 20_000
+	total := 0
+	for i := 0; i < n; i++ {
+		f, _ := c.nextFrame()
+		total += len(f.Content)
+	}
+	mean := float64(total) / float64(n)
+	if math.Abs(mean-b0) > 0.05*b0 {
+		t.Errorf("mean frame size %.0f bytes, want %.0f", mean, b0)
+	}
+}
+
+func TestStatisticalCodecFramesChannelClosesOnClose(t *testing.T) {
+	clock := newFakeClock()
+	c, err := NewStatisticalEncoder(nil, WithFrameChannel(4), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Start()
+	}()
+	clock.BlockUntil(1)
+
+	clock.Step()
+	n := 0
+	for f := range c.Frames() {
+		if f.SeqNr != uint64(n) {
+			t.Errorf("frame %v received, want %v", f.SeqNr, n)
+		}
+		n++
+		if n == 10 {
+			c.Close()
+			continue
+		}
+		clock.BlockUntil(1)
+		clock.Step()
+	}
+	<-done
+	if n != 10 {
+		t.Errorf("%v frames received, want 10", n)
+	}
+
+	plain, _, _ := newTestEncoder(t)
+	if plain.Frames() != nil {
+		t.Error("frame channel enabled without WithFrameChannel")
+	}
+}
+
+func TestStatisticalCodecShedsTopSpatialLayer(t *testing.T) {
+	c, w, clock := newTestEncoder(t, WithInitialTargetBitrate(defaultRMax), WithSpatialLayers([]float64{0.25, 0.25, 0.5}))
+	startCodec(t, c)
+	clock.BlockUntil(1)
+
+	// Each picture yields one frame per active layer, written at once.
+	layers := func() []int {
+		clock.Step()
+		ids := []int{}
+		for {
+			f := receiveFrame(t, w)
+			ids = append(ids, f.SpatialLayerID)
+			if f.Duration > 0 {
+				return ids
+			}
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if got := layers(); fmt.Sprint(got) != "[0 1 2]" {
+			t.Errorf("picture %v has spatial layers %v, want [0 1 2]", i, got)
+		}
+	}
+	// At 400 kbps, the top layer would leave 100 kbps to each lower layer,
+	// which is below the minimum bitrate.
+	c.SetTargetBitrate(400_000)
+	for i := 0; i < 3; i++ {
+		if got := layers(); fmt.Sprint(got) != "[0 1]" {
+			t.Errorf("picture %v at 400 kbps has spatial layers %v, want [0 1]", i, got)
+		}
+	}
+}
+
+// stallingWriter blocks the first write until an error is sent on release and
+// accepts all further writes at once.
+type stallingWriter struct {
+	started chan struct{}
+	release chan error
+	calls   uint64
+}
+
+func (w *stallingWriter) WriteFrame(Frame) error {
+	if atomic.AddUint64(&w.calls, 1) == 1 {
+		close(w.started)
+		return <-w.release
+	}
+	return nil
+}
+
+func TestStatisticalCodecWriteTimeoutKeepsProcessingRateUpdates(t *testing.T) {
+	clock := newFakeClock()
+	w := &stallingWriter{
+		started: make(chan struct{}),
+		release: make(chan error),
+	}
+	timeout := 5 * time.Millisecond
+	c, err := NewStatisticalEncoder(w, WithClock(clock), WithRandSeed(1), WithWriteTimeout(timeout), WithReactionLatency(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	startCodec(t, c)
+	t.Cleanup(func() {
+		close(w.release)
+	})
+	clock.BlockUntil(1)
+	clock.Step()
+	<-w.started
+	clock.BlockUntil(2)
+	clock.Advance(timeout)
+	waitFor(t, func() bool { return c.Stats().WriteTimeouts == 1 })
+
+	c.RequestTargetBitrate(500_000)
+	waitFor(t, func() bool { return c.GetTargetBitrate() == 500_000 })
+	for i := uint64(2); i <= 5; i++ {
+		clock.Step()
+		want := i
+		waitFor(t, func() bool { return c.Stats().WriteTimeouts == want })
+	}
+	if calls := atomic.LoadUint64(&w.calls); calls != 1 {
+		t.Errorf("writer called %v times while blocked, want 1", calls)
+	}
+}
+
+func TestStatisticalCodecFailedConstructionStartsNoWriteWorker(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		_, err := NewStatisticalEncoder(newChanWriter(),
+			WithWriteTimeout(time.Millisecond),
+			WithRateBounds(100_000, 200_000),
+			WithInitialTargetBitrate(300_000),
+		)
+		if err == nil {
+			t.Fatal("expected error for initial target bitrate out of range")
+		}
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("%v goroutines after failed constructions, %v before", after, before)
+	}
+}
+
+func TestStatisticalCodecBurstAndPostBurstSizesAreDeterministic(t *testing.T) {
+	c, _, _ := newTestEncoder(t)
+	c.updateTargetBitrate(defaultTargetBitrateBps)
+	nominal := time.Second / defaultFPS
+	// The burst spends the budget of 8 frames of 4166 bytes: a frame of
+	// 13500 bytes followed by 7 frames of (8*4166-13500)/7 bytes.
+	for i := 0; i < defaultBurstFrameCount; i++ {
+		want := 2832
+		if i == 0 {
+			want = defaultBurstFrameSize
+		}
+		f, _ := c.nextFrame()
+		if len(f.Content) != want || f.Duration != nominal {
+			t.Errorf("burst frame %v has %v bytes and duration %v, want %v bytes and %v", i, len(f.Content), f.Duration, want, nominal)
+		}
+	}
+
+	// The noise sources do not advance during the burst, so the frames after
+	// the burst are the first noised frames of a codec without burst.
+	postBurst := []struct {
+		size     int
+		duration time.Duration
+	}{
+		{4200, 34748349 * time.Nanosecond},
+		{3652, 42976311 * time.Nanosecond},
+	}
+	steady, _, _ := newTestEncoder(t)
+	for i, want := range postBurst {
+		f, _ := c.nextFrame()
+		if len(f.Content) != want.size || f.Duration != want.duration {
+			t.Errorf("frame %v after burst has %v bytes and duration %v, want %v bytes and %v", i, len(f.Content), f.Duration, want.size, want.duration)
+		}
+		if s, _ := steady.nextFrame(); len(s.Content) != len(f.Content) || s.Duration != f.Duration {
+			t.Errorf("frame %v after burst differs from frame %v of a codec without burst", i, i)
+		}
+	}
+}
+
+func TestStatisticalCodecWindowedStats(t *testing.T) {
+	const window = 500 * time.Millisecond
+	c, w, clock := newTestEncoder(t, WithStatsWindow(window))
+	startCodec(t, c)
+	clock.BlockUntil(1)
+
+	frames := nextFrames(t, clock, w, 60)
+	waitFor(t, func() bool { return c.Stats().FramesEmitted == 60 })
+	check := func() {
+		t.Helper()
+		now := clock.Now()
+		wantFrames, wantBytes := uint64(0), uint64(0)
+		for _, f := range frames {
+			if now.Sub(f.CaptureTime) < window {
+				wantFrames++
+				wantBytes += uint64(len(f.Content))
+			}
+		}
+		stats := c.Stats()
+		if stats.Window != window || stats.WindowFrames != wantFrames || stats.WindowBytes != wantBytes {
+			t.Errorf("window of %v has %v frames and %v bytes, want %v of %v with %v frames and %v bytes",
+				stats.Window, stats.WindowFrames, stats.WindowBytes, window, window, wantFrames, wantBytes)
+		}
+	}
+	check()
+	// Let the oldest frames of the window expire without a new frame.
+	clock.Advance(frames[len(frames)-1].Duration / 2)
+	check()
+
+	c.Pause()
+	clock.Advance(window)
+	if stats := c.Stats(); stats.WindowFrames != 0 || stats.WindowBytes != 0 {
+		t.Errorf("window has %v frames and %v bytes after a paused window", stats.WindowFrames, stats.WindowBytes)
+	}
+}
+
+func TestStatisticalCodecHigherQuantizerShrinksFrames(t *testing.T) {
+	c, _, _ := newTestEncoder(t, WithQuantizer(16), WithQuantizerExponent(1.5))
+	averageSize := func(qp int) float64 {
+		if err := c.SetQuantizer(qp); err != nil {
+			t.Fatal(err)
+		}
+		total := 0
+		for i := 0; i < 1000; i++ {
+			f, _ := c.nextFrame()
+			total += len(f.Content)
+		}
+		return float64(total) / 1000
+	}
+	previous := math.Inf(1)
+	for _, qp := range []int{16, 32, 64, 127} {
+		avg := averageSize(qp)
+		if avg >= previous {
+			t.Errorf("average frame size %.0f at quantizer %v, want below %.0f", avg, qp, previous)
+		}
+		if want := defaultB0 * math.Pow(float64(referenceQP)/float64(qp), 1.5); math.Abs(avg-want) > 0.05*want {
+			t.Errorf("average frame size %.0f at quantizer %v, want %.0f", avg, qp, want)
+		}
+		previous = avg
+	}
+	for _, qp := range []int{0, maxQP + 1} {
+		if err := c.SetQuantizer(qp); err == nil {
+			t.Errorf("expected error for quantizer %v", qp)
+		}
+	}
+}
+
+func TestStatisticalCodecZeroTauAppliesEveryUpdate(t *testing.T) {
+	c, _, _ := newTestEncoder(t, WithReactionLatency(0))
+	for _, r := range []int{300_000, 600_000, 900_000} {
+		c.updateTargetBitrate(r)
+		if got := c.GetTargetBitrate(); got != r {
+			t.Errorf("target bitrate %v, want %v", got, r)
+		}
+		if c.remainingBurstFrames != defaultBurstFrameCount {
+			t.Errorf("update to %v bps started no burst", r)
+		}
+	}
+}
+
+func TestStatisticalCodecFirstUpdateAfterStartRespectsTau(t *testing.T) {
+	c, w, clock := newTestEncoder(t)
+	start := clock.Now()
+	startCodec(t, c)
+	clock.BlockUntil(1)
+
+	// request hands r to the run loop and returns the target bitrate of the
+	// next frame, which is generated after the run loop handled r.
+	request := func(r int) int {
+		requested := clock.Now()
+		c.RequestTargetBitrate(r)
+		waitFor(t, func() bool { return len(c.targetBitrateChan) == 0 })
+		for {
+			// Skip frames generated before the request.
+			if f := nextFrames(t, clock, w, 1)[0]; f.CaptureTime.After(requested) {
+				return f.TargetBitrate
+			}
+		}
+	}
+	if got := request(300_000); got != defaultTargetBitrateBps {
+		t.Errorf("update within tau of Start applied, frame has target bitrate %v", got)
+	}
+	clock.Advance(defaultTau - clock.Now().Sub(start))
+	clock.BlockUntil(1)
+	if got := request(600_000); got != 600_000 {
+		t.Errorf("update tau after Start ignored, frame has target bitrate %v", got)
+	}
+}
+
+func TestStatisticalCodecCaptureTimeAdvancesByFrameInterval(t *testing.T) {
+	c, w, clock := newTestEncoder(t)
+	start := clock.Now()
+	startCodec(t, c)
+	clock.BlockUntil(1)
+
+	frames := nextFrames(t, clock, w, 20)
+	if got := frames[0].CaptureTime.Sub(start); got != defaultT0 {
+		t.Errorf("first frame captured %v after start, want %v", got, defaultT0)
+	}
+	for i := 1; i < len(frames); i++ {
+		// Without schedule jitter, the next frame is due after the noised
+		// duration of the previous frame.
+		if got, want := frames[i].CaptureTime.Sub(frames[i-1].CaptureTime), frames[i-1].Duration; got != want {
+			t.Errorf("frame %v captured %v after frame %v, want %v", i, got, i-1, want)
+		}
+		if got, want := frames[i].CaptureTime.Sub(frames[0].CaptureTime), frames[i].PTS; got != want {
+			t.Errorf("frame %v captured at %v, want its PTS %v", i, got, want)
+		}
+	}
+}
+
+// halvingRateController halves the target bitrate once after n frames.
+type halvingRateController struct {
+	n      int
+	frames int
+}
+
+func (rc *halvingRateController) OnFrame(f Frame) (int, bool) {
+	rc.frames++
+	if rc.frames != rc.n {
+		return 0, false
+	}
+	return f.TargetBitrate / 2, true
+}
+
+func TestStatisticalCodecReactsToRateController(t *testing.T) {
+	c, w, clock := newTestEncoder(t, WithRateController(&halvingRateController{n: 10}))
+	startCodec(t, c)
+	clock.BlockUntil(1)
+
+	frames := nextFrames(t, clock, w, 12)
+	for i, f := range frames {
+		want := defaultTargetBitrateBps
+		if i >= 10 {
+			want = defaultTargetBitrateBps / 2
+		}
+		if f.TargetBitrate != want {
+			t.Errorf("frame %v has target bitrate %v, want %v", i, f.TargetBitrate, want)
+		}
+	}
+	// The update starts a transient burst.
+	if got := len(frames[10].Content); got != defaultBurstFrameSize {
+		t.Errorf("first frame after the update has %v bytes, want %v", got, defaultBurstFrameSize)
+	}
+}
+
+func TestSteadyStateFrameBytes(t *testing.T) {
+	for _, tc := range []struct {
+		bitrateBps, fps, want int
+	}{
+		{1_000_000, 30, 4166},
+		{240_000, 30, 1000},
+		{8, 1, 1},
+		{7, 1, 0},
+		{0, 30, 0},
+		{1_000_000, maxFPS, 125},
+		{math.MaxInt32, 1, math.MaxInt32 / 8},
+		{math.MaxInt32, maxFPS, math.MaxInt32 / 8 / maxFPS},
+	} {
+		if got := steadyStateFrameBytes(tc.bitrateBps, tc.fps); got != tc.want {
+			t.Errorf("steadyStateFrameBytes(%v, %v) = %v, want %v", tc.bitrateBps, tc.fps, got, tc.want)
+		}
+	}
+}
+
+func TestStatisticalCodecRandSourceReproducesScenario(t *testing.T) {
+	scenario := func(masterSeed int64) [][]int {
+		src := rand.NewSource(masterSeed)
+		sizes := make([][]int, 5)
+		for i := range sizes {
+			c, _, _ := newTestEncoder(t, WithRandSource(src))
+			for j := 0; j < 20; j++ {
+				f, _ := c.nextFrame()
+				sizes[i] = append(sizes[i], len(f.Content))
+			}
+		}
+		return sizes
+	}
+	first, second := scenario(42), scenario(42)
+	if fmt.Sprint(first) != fmt.Sprint(second) {
+		t.Error("scenarios with the same master seed differ")
+	}
+	for i := 1; i < len(first); i++ {
+		if fmt.Sprint(first[i]) == fmt.Sprint(first[0]) {
+			t.Errorf("codec %v generates the same frames as codec 0", i)
+		}
+	}
+	if fmt.Sprint(scenario(43)) == fmt.Sprint(first) {
+		t.Error("scenarios with different master seeds are identical")
+	}
+}
+
+// errWriter is a FrameWriter which fails every write.
+type errWriter struct {
+	err error
+}
+
+func (w errWriter) WriteFrame(Frame) error {
+	return w.err
+}
+
+// countingRateController counts the frames it is notified of.
+type countingRateController struct {
+	frames uint64
+}
+
+func (rc *countingRateController) OnFrame(Frame) (int, bool) {
+	atomic.AddUint64(&rc.frames, 1)
+	return 0, false
+}
+
+func TestStatisticalCodecErrorPolicyCount(t *testing.T) {
+	errWrite := errors.New("write failed")
+	clock := newFakeClock()
+	rc := &countingRateController{}
+	c, err := NewStatisticalEncoder(errWriter{errWrite}, WithClock(clock), WithRandSeed(1), WithRateController(rc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	startCodec(t, c)
+	clock.BlockUntil(1)
+
+	for i := 1; i <= 3; i++ {
+		clock.Step()
+		want := uint64(i)
+		waitFor(t, func() bool { return c.Stats().WriteErrors == want })
+	}
+	stats := c.Stats()
+	if stats.LastWriteError != errWrite {
+		t.Errorf("last write error %v, want %v", stats.LastWriteError, errWrite)
+	}
+	if stats.FramesEmitted != 0 {
+		t.Errorf("%v failed frames counted as emitted", stats.FramesEmitted)
+	}
+	if n := atomic.LoadUint64(&rc.frames); n != 0 {
+		t.Errorf("rate controller notified of %v failed frames", n)
+	}
+}
+
+func TestStatisticalCodecErrorPolicyStop(t *testing.T) {
+	clock := newFakeClock()
+	c, err := NewStatisticalEncoder(errWriter{errors.New("write failed")}, WithClock(clock), WithRandSeed(1), WithErrorPolicy(ErrorPolicyStop))
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Start()
+	}()
+	clock.BlockUntil(1)
+	clock.Step()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("codec did not stop after write error")
+	}
+	if got := c.Stats().WriteErrors; got != 1 {
+		t.Errorf("%v write errors, want 1", got)
+	}
+}
+
+func TestStatisticalCodecHandlesErrorOfAbandonedWrite(t *testing.T) {
+	errLate := errors.New("late write failed")
+	clock := newFakeClock()
+	w := &stallingWriter{
+		started: make(chan struct{}),
+		release: make(chan error),
+	}
+	timeout := 5 * time.Millisecond
+	c, err := NewStatisticalEncoder(w, WithClock(clock), WithRandSeed(1), WithWriteTimeout(timeout), WithErrorPolicy(ErrorPolicyStop))
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Start()
+	}()
+	clock.BlockUntil(1)
+	clock.Step()
+	<-w.started
+
+	// frame timer and write timer
+	clock.BlockUntil(2)
+	clock.Advance(timeout)
+	waitFor(t, func() bool { return c.Stats().WriteTimeouts == 1 })
+	w.release <- errLate
+
+	// Frames generated before the codec notices the completed write are
+	// dropped as well.
+	for {
+		select {
+		case <-done:
+			stats := c.Stats()
+			if stats.WriteErrors != 1 || stats.LastWriteError != errLate {
+				t.Errorf("write errors %v, last %v, want 1, %v", stats.WriteErrors, stats.LastWriteError, errLate)
+			}
+			return
+		default:
+		}
+		before := c.Stats().WriteTimeouts
+		clock.Step()
+		waitFor(t, func() bool {
+			select {
+			case <-done:
+				return true
+			default:
+				return c.Stats().WriteTimeouts > before
+			}
+		})
+	}
+}
+
+func TestStatisticalCodecTransientShapesSpendEqualBudget(t *testing.T) {
+	for _, bitrate := range []int{defaultRMin, defaultTargetBitrateBps} {
+		bytesPerFrame := bitrate / 8 / defaultFPS
+		firstSizes := []int{}
+		for _, shape := range []TransientShape{TransientSquare, TransientExponential, TransientLinear} {
+			c, _, _ := newTestEncoder(t, WithInitialTargetBitrate(bitrate), WithSizeNoiseScale(0), WithTransientShape(shape))
+			c.updateTargetBitrate(bitrate)
+			total := 0
+			for i := 0; i < defaultBurstFrameCount; i++ {
+				f, _ := c.nextFrame()
+				if i == 0 {
+					firstSizes = append(firstSizes, len(f.Content))
+				}
+				total += len(f.Content)
+			}
+			// Deficits of negative compensation frames are carried over.
+			total += c.carryBytes
+			// Each frame size is rounded by less than one byte.
+			want := defaultBurstFrameCount * bytesPerFrame
+			if total > want+defaultBurstFrameCount || total < want-defaultBurstFrameCount {
+				t.Errorf("shape %v at %v bps spends %v bytes, want %v", shape, bitrate, total, want)
+			}
+		}
+		if firstSizes[0] <= firstSizes[1] || firstSizes[1] <= firstSizes[2] {
+			t.Errorf("first burst frames %v at %v bps not decreasing from square to linear shape", firstSizes, bitrate)
+		}
+	}
+}
+
+func TestStatisticalCodecStartAfterClose(t *testing.T) {
+	// startClosed runs Start of the closed codec c and fails the test unless
+	// it returns at once.
+	startClosed := func(c *StatisticalCodec, clock *fakeClock, w chanWriter) {
+		t.Helper()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			c.Start()
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Start of closed codec did not return")
+		}
+		clock.Advance(time.Second)
+		expectNoFrame(t, w)
+	}
+
+	// Close before Start.
+	c, w, clock := newTestEncoder(t, WithFrameChannel(1))
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	startClosed(c, clock, w)
+	if _, ok := <-c.Frames(); ok {
+		t.Error("frame channel open after Close")
+	}
+
+	// Close after a run.
+	c, w, clock = newTestEncoder(t)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Start()
+	}()
+	clock.BlockUntil(1)
+	nextFrames(t, clock, w, 2)
+	c.Close()
+	<-done
+	startClosed(c, clock, w)
+}
+
+func TestStatisticalCodecScheduleJitterKeepsConstantDuration(t *testing.T) {
+	c, w, clock := newTestEncoder(t, WithScheduleJitter(NewLaplaceNoiser(0.2, rand.NewSource(1))))
+	startCodec(t, c)
+	clock.BlockUntil(1)
+
+	frames := nextFrames(t, clock, w, 30)
+	nominal := time.Second / defaultFPS
+	intervals := map[time.Duration]bool{}
+	for i, f := range frames {
+		if f.Duration != nominal {
+			t.Errorf("frame %v has duration %v, want %v", i, f.Duration, nominal)
+		}
+		if i > 0 {
+			intervals[f.CaptureTime.Sub(frames[i-1].CaptureTime)] = true
+		}
+	}
+	if len(intervals) < 2 {
+		t.Errorf("constant emission interval despite schedule jitter")
+	}
+}
+
+func TestStatisticalCodecWithoutBurst(t *testing.T) {
+	c, _, clock := newTestEncoder(t, WithoutBurst(), WithSizeNoiseScale(0))
+	for _, bitrate := range []int{defaultTargetBitrateBps, 300_000, 1_200_000} {
+		if bitrate != defaultTargetBitrateBps {
+			clock.Advance(defaultTau)
+			c.updateTargetBitrate(bitrate)
+		}
+		want := steadyStateFrameBytes(bitrate, defaultFPS)
+		for i := 0; i < 2*defaultBurstFrameCount; i++ {
+			if f, _ := c.nextFrame(); len(f.Content) != want {
+				t.Fatalf("frame %v at %v bps has %v bytes, want steady state size %v", i, bitrate, len(f.Content), want)
+			}
+		}
+		if c.remainingBurstFrames != 0 {
+			t.Errorf("%v burst frames remaining at %v bps", c.remainingBurstFrames, bitrate)
+		}
+	}
+}
+
+func TestStatisticalCodecBurstLastsBurstFrameCount(t *testing.T) {
+	c, _, _ := newTestEncoder(t, WithSizeNoiseScale(0), WithDurationNoiseScale(0))
+	steady, _ := c.nextFrame()
+	c.updateTargetBitrate(defaultTargetBitrateBps)
+
+	burst := 0
+	for i := 0; i < 3*defaultBurstFrameCount; i++ {
+		f, _ := c.nextFrame()
+		if len(f.Content) == len(steady.Content) {
+			continue
+		}
+		if i != burst {
+			t.Errorf("burst frame %v follows steady state frame", i)
+		}
+		burst++
+	}
+	if burst != defaultBurstFrameCount {
+		t.Errorf("%v burst frames, want %v", burst, defaultBurstFrameCount)
+	}
+}
+
+func TestStatisticalCodecDefersKeyFrameDuringBurst(t *testing.T) {
+	c, _, _ := newTestEncoder(t, WithGOPSize(10))
+	keyFrames := []int{}
+	for i := 0; i < 25; i++ {
+		if i == 8 {
+			c.updateTargetBitrate(defaultTargetBitrateBps)
+		}
+		f, _ := c.nextFrame()
+		if f.IsKeyFrame {
+			keyFrames = append(keyFrames, i)
+		}
+	}
+	// The key frame due at frame 10 falls into the burst of frames 8 to 15.
+	want := []int{0, 16, 20}
+	if fmt.Sprint(keyFrames) != fmt.Sprint(want) {
+		t.Errorf("key frames %v, want %v", keyFrames, want)
+	}
+}
+
+func TestStatisticalCodecBurstDecay(t *testing.T) {
+	const decayFrames = 4
+	c, _, _ := newTestEncoder(t, WithBurstDecay(decayFrames), WithSizeNoiseScale(0))
+	c.updateTargetBitrate(defaultTargetBitrateBps)
+	for i := 0; i < defaultBurstFrameCount; i++ {
+		c.nextFrame()
+	}
+	steady := steadyStateFrameBytes(defaultTargetBitrateBps, defaultFPS)
+	previous := defaultBurstFrameSize
+	for i := 1; i <= decayFrames+2; i++ {
+		f, _ := c.nextFrame()
+		want := steady
+		if i <= decayFrames {
+			want += int(float64(defaultBurstFrameSize-steady) * float64(decayFrames+1-i) / float64(decayFrames+1))
+		}
+		if len(f.Content) != want {
+			t.Errorf("frame %v after burst has %v bytes, want %v", i, len(f.Content), want)
+		}
+		if len(f.Content) > previous || (i <= decayFrames && len(f.Content) == previous) {
+			t.Errorf("frame %v after burst has %v bytes, not declining from %v", i, len(f.Content), previous)
+		}
+		previous = len(f.Content)
+	}
+}
+
+func TestStatisticalCodecMinBurstInterval(t *testing.T) {
+	c, _, clock := newTestEncoder(t, WithReactionLatency(0), WithMinBurstInterval(time.Second))
+	c.updateTargetBitrate(600_000)
+	c.nextFrame()
+	// A second update during the burst changes the rate without a new
+	// burst.
+	c.updateTargetBitrate(900_000)
+	if c.remainingBurstFrames != defaultBurstFrameCount-1 {
+		t.Errorf("%v burst frames remaining after second update, want %v", c.remainingBurstFrames, defaultBurstFrameCount-1)
+	}
+	if got := c.GetTargetBitrate(); got != 900_000 {
+		t.Errorf("target bitrate %v, want 900000", got)
+	}
+	for c.remainingBurstFrames > 0 {
+		c.nextFrame()
+	}
+
+	clock.Advance(time.Second - time.Nanosecond)
+	c.updateTargetBitrate(300_000)
+	if c.remainingBurstFrames != 0 {
+		t.Error("burst started within the minimum burst interval")
+	}
+	if got := c.GetTargetBitrate(); got != 300_000 {
+		t.Errorf("target bitrate %v, want 300000", got)
+	}
+	clock.Advance(time.Nanosecond)
+	c.updateTargetBitrate(600_000)
+	if c.remainingBurstFrames != defaultBurstFrameCount {
+		t.Error("no burst after the minimum burst interval")
+	}
+}
+
+func TestStatisticalCodecFixedScheduleStaysOnGrid(t *testing.T) {
+	c, w, clock := newTestEncoder(t, WithFixedSchedule())
+	start := clock.Now()
+	startCodec(t, c)
+	clock.BlockUntil(1)
+
+	nominal := time.Second / defaultFPS
+	durations := map[time.Duration]bool{}
+	for i, f := range nextFrames(t, clock, w, 1000) {
+		if want := defaultT0 + time.Duration(i)*nominal; f.CaptureTime.Sub(start) != want {
+			t.Fatalf("frame %v written at %v, want %v", i, f.CaptureTime.Sub(start), want)
+		}
+		durations[f.Duration] = true
+	}
+	if len(durations) < 2 {
+		t.Error("duration noise not applied to reported durations")
+	}
+}
+
+func TestStatisticalCodecPhaseTransitions(t *testing.T) {
+	c, w, clock := newTestEncoder(t)
+	start := clock.Now()
+	startCodec(t, c)
+	clock.BlockUntil(1)
+	if got := c.CurrentPhase(); got != PhaseSteady {
+		t.Fatalf("phase %v after start, want steady", got)
+	}
+
+	clock.Advance(defaultTau - clock.Now().Sub(start))
+	clock.BlockUntil(1)
+	c.RequestTargetBitrate(500_000)
+	waitFor(t, func() bool { return c.CurrentPhase() == PhaseBurst })
+	// Discard the frames written before the update.
+	for len(w) > 0 {
+		<-w
+	}
+	emitted := c.Stats().FramesEmitted
+	for i := 1; i <= defaultBurstFrameCount; i++ {
+		nextFrames(t, clock, w, 1)
+		emitted++
+		waitFor(t, func() bool { return c.Stats().FramesEmitted == emitted })
+		want := PhaseBurst
+		if i == defaultBurstFrameCount {
+			want = PhaseSteady
+		}
+		if got := c.CurrentPhase(); got != want {
+			t.Errorf("phase %v after burst frame %v, want %v", got, i, want)
+		}
+	}
+}
+
+func TestStatisticalCodecPhaseDuringRamp(t *testing.T) {
+	c, _, clock := newTestEncoder(t, WithRateRamp(100_000, 100*time.Millisecond))
+	c.SetTargetBitrate(defaultTargetBitrateBps - 300_000)
+	if got := c.CurrentPhase(); got != PhaseRamp {
+		t.Errorf("phase %v after rate change, want ramp", got)
+	}
+	clock.Advance(300 * time.Millisecond)
+	c.nextFrame()
+	if got := c.CurrentPhase(); got != PhaseSteady {
+		t.Errorf("phase %v after the ramp reached the target, want steady", got)
+	}
+}
+
+func TestStatisticalCodecNextFrameIn(t *testing.T) {
+	c, w, clock := newTestEncoder(t)
+	if got := c.NextFrameIn(); got != 0 {
+		t.Errorf("next frame in %v before start, want 0", got)
+	}
+	startCodec(t, c)
+	clock.BlockUntil(1)
+	if got := c.NextFrameIn(); got != defaultT0 {
+		t.Errorf("next frame in %v after start, want %v", got, defaultT0)
+	}
+
+	for i := 0; i < 5; i++ {
+		f := nextFrames(t, clock, w, 1)[0]
+		// The next frame is due after the duration of the written frame.
+		if got := c.NextFrameIn(); got != f.Duration {
+			t.Errorf("next frame in %v after frame %v, want %v", got, i, f.Duration)
+		}
+		clock.Advance(f.Duration / 4)
+		if got, want := c.NextFrameIn(), f.Duration-f.Duration/4; got != want {
+			t.Errorf("next frame in %v a quarter interval after frame %v, want %v", got, i, want)
+		}
+	}
+}
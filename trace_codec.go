@@ -0,0 +1,251 @@
+package syncodec
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var _ Codec = (*TraceCodec)(nil)
+
+// TraceCodec replays a recorded sequence of frames. Each frame is written to
+// the FrameWriter after the duration of the previous frame has elapsed.
+type TraceCodec struct {
+	writer FrameWriter
+
+	frames []Frame
+
+	// restart at the first frame after the last frame was written
+	loop bool
+
+	// factor by which the replay is faster than the recording
+	speed float64
+
+	// source of time of the replay
+	clock Clock
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type TraceCodecOption func(*TraceCodec) error
+
+// WithLoop sets whether the TraceCodec restarts at the beginning of the trace
+// after the last frame was written. If loop is false, Start returns at the end
+// of the trace.
+func WithLoop(loop bool) TraceCodecOption {
+	return func(tc *TraceCodec) error {
+		tc.loop = loop
+		return nil
+	}
+}
+
+// WithPlaybackSpeed replays the trace factor times faster than it was
+// recorded, e.g. 2 for fast-forward or 0.5 for slow motion. The interval
+// between writing two frames is divided by factor, while the sizes, durations
+// and PTS of the frames stay the same.
+func WithPlaybackSpeed(factor float64) TraceCodecOption {
+	return func(tc *TraceCodec) error {
+		if factor <= 0 {
+			return errors.New("playback speed must be positive")
+		}
+		tc.speed = factor
+		return nil
+	}
+}
+
+// WithTraceClock replaces the clock the TraceCodec uses to schedule frames,
+// e.g. to replay traces in virtual time.
+func WithTraceClock(clock Clock) TraceCodecOption {
+	return func(tc *TraceCodec) error {
+		if clock == nil {
+			return errors.New("clock must not be nil")
+		}
+		tc.clock = clock
+		return nil
+	}
+}
+
+// ReadTrace parses a trace of frames from r. Each line of the trace is a
+// comma separated record of the form duration_ms,size_bytes. Lines starting
+// with '#' are ignored. Alternatively, the first line may be a header naming
+// the columns, in which case the columns duration_ms and size_bytes are used
+// and all other columns are ignored. This allows to replay CSV traces written
+// by a TraceRecorder.
+func ReadTrace(r io.Reader) ([]Frame, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = 0
+	cr.TrimLeadingSpace = true
+
+	durationColumn, sizeColumn := 0, 1
+	frames := []Frame{}
+	for first := true; ; first = false {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return frames, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if first {
+			if _, err := strconv.ParseFloat(record[0], 64); err != nil {
+				durationColumn, sizeColumn = -1, -1
+				for i, name := range record {
+					switch name {
+					case "duration_ms":
+						durationColumn = i
+					case "size_bytes":
+						sizeColumn = i
+					}
+				}
+				if durationColumn < 0 || sizeColumn < 0 {
+					return nil, fmt.Errorf("trace header %v lacks duration_ms or size_bytes column", record)
+				}
+				continue
+			}
+			if len(record) != 2 {
+				return nil, fmt.Errorf("invalid frame record %v", record)
+			}
+		}
+		ms, err := strconv.ParseFloat(record[durationColumn], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid frame duration %q: %w", record[durationColumn], err)
+		}
+		size, err := strconv.Atoi(record[sizeColumn])
+		if err != nil {
+			return nil, fmt.Errorf("invalid frame size %q: %w", record[sizeColumn], err)
+		}
+		frame, err := newTraceFrame(ms, size)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, frame)
+	}
+}
+
+// ReadJSONTrace parses a trace of frames written by a TraceRecorder in
+// TraceFormatJSON from r.
+func ReadJSONTrace(r io.Reader) ([]Frame, error) {
+	decoder := json.NewDecoder(r)
+	frames := []Frame{}
+	for {
+		var record traceRecord
+		err := decoder.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			return frames, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		frame, err := newTraceFrame(record.DurationMs, record.SizeBytes)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, frame)
+	}
+}
+
+func newTraceFrame(durationMs float64, sizeBytes int) (Frame, error) {
+	if durationMs < 0 || sizeBytes < 0 {
+		return Frame{}, fmt.Errorf("invalid negative frame duration %v ms or size %v bytes", durationMs, sizeBytes)
+	}
+	return Frame{
+		Content:  make([]byte, sizeBytes),
+		Duration: time.Duration(durationMs * float64(time.Millisecond)),
+	}, nil
+}
+
+// NewTraceCodec returns a TraceCodec replaying frames to w. It returns an error
+// if w is nil, the trace is empty, or a looping trace has a total duration of
+// zero, which would replay frames without ever waiting.
+func NewTraceCodec(w FrameWriter, frames []Frame, opts ...TraceCodecOption) (*TraceCodec, error) {
+	if w == nil {
+		return nil, errors.New("writer must not be nil")
+	}
+	if len(frames) == 0 {
+		return nil, errors.New("trace must contain at least one frame")
+	}
+	tc := &TraceCodec{
+		writer: w,
+		frames: frames,
+		loop:   false,
+		speed:  1,
+		clock:  realClock{},
+		done:   make(chan struct{}),
+	}
+	for _, opt := range opts {
+		if err := opt(tc); err != nil {
+			return nil, err
+		}
+	}
+	if tc.loop {
+		total := time.Duration(0)
+		for _, f := range frames {
+			total += f.Duration
+		}
+		if total <= 0 {
+			return nil, errors.New("looping trace must have a positive total duration")
+		}
+	}
+	return tc, nil
+}
+
+// GetTargetBitrate returns the average bitrate of the trace in bit per second.
+func (c *TraceCodec) GetTargetBitrate() int {
+	return AverageBitrate(c.frames)
+}
+
+// SetTargetBitrate has no effect, since the frames of a trace are fixed.
+func (c *TraceCodec) SetTargetBitrate(int) {}
+
+// Start replays the trace and blocks until the end of the trace is reached or
+// Close is called. Errors returned by the FrameWriter are ignored.
+func (c *TraceCodec) Start() {
+	timer := c.clock.NewTimer(0)
+	defer timer.Stop()
+
+	next := 0
+	seqNr := uint64(0)
+	pts := time.Duration(0)
+	for {
+		select {
+		case <-timer.C():
+			if next == len(c.frames) {
+				if !c.loop {
+					return
+				}
+				next = 0
+			}
+			f := c.frames[next]
+			next++
+			timer.Reset(time.Duration(float64(f.Duration) / c.speed))
+			c.writer.WriteFrame(Frame{
+				Content:     make([]byte, len(f.Content)),
+				Duration:    f.Duration,
+				SeqNr:       seqNr,
+				PTS:         pts,
+				CaptureTime: c.clock.Now(),
+				IsKeyFrame:  f.IsKeyFrame,
+			})
+			seqNr++
+			pts += f.Duration
+
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Close stops the TraceCodec. Calling Close more than once has no effect.
+func (c *TraceCodec) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	return nil
+}
@@ -0,0 +1,177 @@
+package syncodec
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadTraceHeaderless(t *testing.T) {
+	trace := "# duration_ms,size_bytes\n40,1000\n\n33.5, 500\n"
+	frames, err := ReadTrace(strings.NewReader(trace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Frame{
+		{Content: make([]byte, 1000), Duration: 40 * time.Millisecond},
+		{Content: make([]byte, 500), Duration: 33500 * time.Microsecond},
+	}
+	if len(frames) != len(want) {
+		t.Fatalf("read %v frames, want %v", len(frames), len(want))
+	}
+	for i, f := range frames {
+		if len(f.Content) != len(want[i].Content) || f.Duration != want[i].Duration {
+			t.Errorf("frame %v has %v bytes and duration %v, want %v bytes and %v", i, len(f.Content), f.Duration, len(want[i].Content), want[i].Duration)
+		}
+	}
+}
+
+func TestReadTraceErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		trace string
+	}{
+		{"invalid duration", "40,1000\nabc,1000\n"},
+		{"invalid size", "40,1000\n40,abc\n"},
+		{"negative size", "40,-1\n"},
+		{"negative duration", "-40,1000\n"},
+		{"extra column", "40,1000,1\n"},
+		{"missing column", "40,1000\n40\n"},
+		{"header without size", "duration_ms,pts_ms\n40,0\n"},
+		{"unterminated quote", "40,\"1000\n"},
+	} {
+		if frames, err := ReadTrace(strings.NewReader(tc.trace)); err == nil {
+			t.Errorf("%v: read %v frames, expected error", tc.name, len(frames))
+		}
+	}
+}
+
+func TestTraceCodecIgnoresSetTargetBitrate(t *testing.T) {
+	frames := []Frame{
+		{Content: make([]byte, 1000), Duration: 100 * time.Millisecond},
+		{Content: make([]byte, 3000), Duration: 100 * time.Millisecond},
+	}
+	c, err := NewTraceCodec(newChanWriter(), frames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.GetTargetBitrate(); got != 160_000 {
+		t.Fatalf("target bitrate %v, want the trace average of 160000", got)
+	}
+	c.SetTargetBitrate(1_000_000)
+	if got := c.GetTargetBitrate(); got != 160_000 {
+		t.Errorf("target bitrate %v after SetTargetBitrate, want the fixed 160000", got)
+	}
+}
+
+// replayDuration replays frames at the given speed under a fake clock and
+// returns the time it took until Start returned.
+func replayDuration(t *testing.T, frames []Frame, speed float64) (time.Duration, []Frame) {
+	t.Helper()
+	clock := newFakeClock()
+	w := newChanWriter()
+	c, err := NewTraceCodec(w, frames, WithPlaybackSpeed(speed), WithTraceClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := clock.Now()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Start()
+	}()
+	// The first frame is written at once, every further step writes the next
+	// frame or ends the replay.
+	for range frames {
+		clock.BlockUntil(1)
+		clock.Step()
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("replay did not end")
+	}
+	close(w)
+	written := []Frame{}
+	for f := range w {
+		written = append(written, f)
+	}
+	return clock.Now().Sub(start), written
+}
+
+func TestTraceCodecPlaybackSpeed(t *testing.T) {
+	frames := []Frame{}
+	for i := 0; i < 10; i++ {
+		frames = append(frames, Frame{Content: make([]byte, 100*(i+1)), Duration: time.Duration(i+1) * 10 * time.Millisecond})
+	}
+	normal, _ := replayDuration(t, frames, 1)
+	if normal != 550*time.Millisecond {
+		t.Errorf("replay took %v, want 550ms", normal)
+	}
+	fast, written := replayDuration(t, frames, 2)
+	if fast != normal/2 {
+		t.Errorf("replay at 2x took %v, want %v", fast, normal/2)
+	}
+	if len(written) != len(frames) {
+		t.Fatalf("%v frames written, want %v", len(written), len(frames))
+	}
+	for i, f := range written {
+		if len(f.Content) != len(frames[i].Content) || f.Duration != frames[i].Duration {
+			t.Errorf("frame %v has %v bytes and duration %v, want %v bytes and %v", i, len(f.Content), f.Duration, len(frames[i].Content), frames[i].Duration)
+		}
+	}
+}
+
+func TestTraceCodecLoop(t *testing.T) {
+	frames := []Frame{
+		{Content: make([]byte, 100), Duration: 10 * time.Millisecond},
+		{Content: make([]byte, 200), Duration: 20 * time.Millisecond},
+	}
+	clock := newFakeClock()
+	w := newChanWriter()
+	c, err := NewTraceCodec(w, frames, WithLoop(true), WithTraceClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Start()
+	}()
+	clock.BlockUntil(1)
+
+	pts := time.Duration(0)
+	for i, f := range nextFrames(t, clock, w, 5) {
+		want := frames[i%len(frames)]
+		if len(f.Content) != len(want.Content) || f.Duration != want.Duration {
+			t.Errorf("frame %v has %v bytes and duration %v, want %v bytes and %v", i, len(f.Content), f.Duration, len(want.Content), want.Duration)
+		}
+		if f.SeqNr != uint64(i) || f.PTS != pts {
+			t.Errorf("frame %v has sequence number %v and PTS %v, want %v and %v", i, f.SeqNr, f.PTS, i, pts)
+		}
+		pts += f.Duration
+	}
+	c.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start did not return after Close")
+	}
+}
+
+func TestNewTraceCodecErrors(t *testing.T) {
+	frames := []Frame{{Content: make([]byte, 100), Duration: 10 * time.Millisecond}}
+	if _, err := NewTraceCodec(nil, frames); err == nil {
+		t.Error("expected error for nil writer")
+	}
+	if _, err := NewTraceCodec(newChanWriter(), nil); err == nil {
+		t.Error("expected error for empty trace")
+	}
+	zero := []Frame{{Content: make([]byte, 100)}, {Content: make([]byte, 100)}}
+	if _, err := NewTraceCodec(newChanWriter(), zero, WithLoop(true)); err == nil {
+		t.Error("expected error for looping trace without duration")
+	}
+	if _, err := NewTraceCodec(newChanWriter(), zero); err != nil {
+		t.Errorf("trace without duration rejected without looping: %v", err)
+	}
+}
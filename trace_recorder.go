@@ -0,0 +1,117 @@
+package syncodec
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var _ FrameWriter = (*TraceRecorder)(nil)
+
+// TraceFormat is the output format of a TraceRecorder.
+type TraceFormat int
+
+const (
+	// TraceFormatCSV writes a header line followed by one comma separated
+	// record per frame. Read it back using ReadTrace.
+	TraceFormatCSV TraceFormat = iota
+
+	// TraceFormatJSON writes one JSON object per line and frame. Read it back
+	// using ReadJSONTrace.
+	TraceFormatJSON
+)
+
+// traceRecord is the record of a single frame written by a TraceRecorder.
+type traceRecord struct {
+	SeqNr      uint64  `json:"seq"`
+	PTSMs      float64 `json:"pts_ms"`
+	DurationMs float64 `json:"duration_ms"`
+	SizeBytes  int     `json:"size_bytes"`
+}
+
+var traceCSVHeader = []string{"seq", "pts_ms", "duration_ms", "size_bytes"}
+
+// TraceRecorder is a FrameWriter which records the sequence number,
+// presentation timestamp, duration and size of each frame to an io.Writer
+// before passing the frame on to another FrameWriter. Recorded traces can be
+// replayed using a TraceCodec.
+type TraceRecorder struct {
+	writer FrameWriter
+	format TraceFormat
+
+	lock          sync.Mutex
+	csvWriter     *csv.Writer
+	jsonEncoder   *json.Encoder
+	headerWritten bool
+	err           error
+}
+
+func NewTraceRecorder(w FrameWriter, out io.Writer, format TraceFormat) *TraceRecorder {
+	return &TraceRecorder{
+		writer:      w,
+		format:      format,
+		csvWriter:   csv.NewWriter(out),
+		jsonEncoder: json.NewEncoder(out),
+	}
+}
+
+// WriteFrame records f and writes it to the wrapped FrameWriter. Frames are
+// written to the wrapped FrameWriter even if recording failed. WriteFrame
+// returns the error of the wrapped FrameWriter if it failed, and the first
+// recording error otherwise. Err returns the first recording error.
+func (r *TraceRecorder) WriteFrame(f Frame) error {
+	r.lock.Lock()
+	if r.err == nil {
+		r.err = r.record(f)
+	}
+	recordErr := r.err
+	r.lock.Unlock()
+
+	if err := r.writer.WriteFrame(f); err != nil {
+		return err
+	}
+	return recordErr
+}
+
+func (r *TraceRecorder) record(f Frame) error {
+	record := traceRecord{
+		SeqNr:      f.SeqNr,
+		PTSMs:      durationToMs(f.PTS),
+		DurationMs: durationToMs(f.Duration),
+		SizeBytes:  len(f.Content),
+	}
+	if r.format == TraceFormatJSON {
+		return r.jsonEncoder.Encode(record)
+	}
+	if !r.headerWritten {
+		if err := r.csvWriter.Write(traceCSVHeader); err != nil {
+			return err
+		}
+		r.headerWritten = true
+	}
+	if err := r.csvWriter.Write([]string{
+		strconv.FormatUint(record.SeqNr, 10),
+		strconv.FormatFloat(record.PTSMs, 'f', -1, 64),
+		strconv.FormatFloat(record.DurationMs, 'f', -1, 64),
+		strconv.Itoa(record.SizeBytes),
+	}); err != nil {
+		return err
+	}
+	r.csvWriter.Flush()
+	return r.csvWriter.Error()
+}
+
+// Err returns the first error that occurred while recording frames.
+func (r *TraceRecorder) Err() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.err
+}
+
+func durationToMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
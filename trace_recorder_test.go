@@ -0,0 +1,49 @@
+package syncodec
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestTraceRecorderRoundTrip(t *testing.T) {
+	c, _, _ := newTestEncoder(t)
+	frames := make([]Frame, 20)
+	for i := range frames {
+		frames[i], _ = c.nextFrame()
+	}
+
+	for format, read := range map[TraceFormat]func(io.Reader) ([]Frame, error){
+		TraceFormatCSV:  ReadTrace,
+		TraceFormatJSON: ReadJSONTrace,
+	} {
+		var trace bytes.Buffer
+		rec := &RecordingFrameWriter{}
+		recorder := NewTraceRecorder(rec, &trace, format)
+		for _, f := range frames {
+			if err := recorder.WriteFrame(f); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if n := len(rec.Frames()); n != len(frames) {
+			t.Errorf("format %v: %v frames passed on, want %v", format, n, len(frames))
+		}
+
+		replayed, err := read(&trace)
+		if err != nil {
+			t.Fatalf("format %v: %v", format, err)
+		}
+		if len(replayed) != len(frames) {
+			t.Fatalf("format %v: read %v frames, want %v", format, len(replayed), len(frames))
+		}
+		for i, f := range replayed {
+			if len(f.Content) != len(frames[i].Content) {
+				t.Errorf("format %v: frame %v has %v bytes, want %v", format, i, len(f.Content), len(frames[i].Content))
+			}
+			if d := f.Duration - frames[i].Duration; d > time.Microsecond || d < -time.Microsecond {
+				t.Errorf("format %v: frame %v has duration %v, want %v", format, i, f.Duration, frames[i].Duration)
+			}
+		}
+	}
+}